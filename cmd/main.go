@@ -6,6 +6,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
@@ -14,12 +17,24 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 	"url-shortener/config"
 	"url-shortener/docs"
 	"url-shortener/internal/api"
+	"url-shortener/internal/cache"
+	"url-shortener/internal/destination"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/geoip"
 	"url-shortener/internal/middleware"
 	"url-shortener/internal/repository"
+	"url-shortener/internal/reserved"
+	"url-shortener/internal/safety"
 	"url-shortener/internal/service"
+	"url-shortener/internal/shortcode"
 )
 
 func main() {
@@ -42,36 +57,307 @@ func main() {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
 
-	urlRepo := repository.NewURLRepository(db)
-	urlService := service.NewURLService(urlRepo)
-	urlHandler := api.NewURLHandler(urlService)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	cacheTTL := envDuration("URL_CACHE_TTL", 5*time.Minute)
+	negativeTTL := envDuration("URL_CACHE_NEGATIVE_TTL", 30*time.Second)
+	var baseRepo domain.URLRepository = repository.NewURLRepository(db)
+	var redisCache *cache.RedisCache
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		redisCache = cache.NewRedisCache(addr, os.Getenv("REDIS_PASSWORD"))
+		baseRepo = repository.NewSharedURLRepository(baseRepo, redisCache, redisCache, cacheTTL, negativeTTL)
+	}
+	urlRepo := repository.NewCachedURLRepository(baseRepo, envInt("URL_CACHE_SIZE", 10000), cacheTTL, negativeTTL)
+	expvar.Publish("url_cache", expvar.Func(func() any { return urlRepo.Stats() }))
+	if redisCache != nil {
+		// Drop local copies of links edited on other replicas
+		go redisCache.Subscribe(ctx, repository.InvalidationChannel, func(message string) {
+			if id, err := strconv.ParseUint(message, 10, 64); err == nil {
+				urlRepo.Invalidate(uint(id))
+			}
+		})
+	}
+	clickRepo := repository.NewClickRepository(db)
+	var urlOpts []service.URLServiceOption
+	if path := os.Getenv("GEOIP_DB_PATH"); path != "" {
+		geo, err := geoip.Open(path)
+		if err != nil {
+			log.Printf("GeoIP disabled: %v", err)
+		} else {
+			urlOpts = append(urlOpts, service.WithGeoLocator(geo))
+		}
+	}
+	if key := os.Getenv("IP_HASH_SECRET"); key != "" {
+		urlOpts = append(urlOpts, service.WithIPHashKey([]byte(key), envDuration("IP_HASH_ROTATION", 24*time.Hour)))
+	} else {
+		log.Printf("IP_HASH_SECRET not set: client addresses are not recorded and variants don't stick by address")
+	}
+	clickRecorder := service.NewClickRecorder(urlRepo, clickRepo, service.ClickRecorderConfig{
+		QueueSize:     envInt("CLICK_QUEUE_SIZE", 0),
+		BatchSize:     envInt("CLICK_BATCH_SIZE", 0),
+		FlushInterval: envDuration("CLICK_FLUSH_INTERVAL", 0),
+	})
+	urlOpts = append(urlOpts, service.WithClickRecorder(clickRecorder))
+	expvar.Publish("click_recorder", expvar.Func(func() any { return clickRecorder.Stats() }))
+	codes, err := shortcode.New(shortcode.Config{
+		Strategy: os.Getenv("SHORT_CODE_STRATEGY"),
+		Length:   envInt("SHORT_CODE_LENGTH", shortcode.DefaultLength),
+		Alphabet: os.Getenv("SHORT_CODE_ALPHABET"),
+	}, repository.NewSequenceRepository(db))
+	if err != nil {
+		log.Fatalf("invalid short code settings: %v", err)
+	}
+	urlOpts = append(urlOpts, service.WithCodeGenerator(codes))
+	// Only aliases created or changed after ALIAS_FOLDING is set are folded, see service.AliasFolding
+	folding, err := service.ParseAliasFolding(os.Getenv("ALIAS_FOLDING"))
+	if err != nil {
+		log.Fatalf("invalid ALIAS_FOLDING: %v", err)
+	}
+	urlOpts = append(urlOpts, service.WithAliasFolding(folding))
+	dests := destination.New(destination.Config{
+		AllowedSchemes: envList("ALLOWED_URL_SCHEMES"),
+		MaxLength:      envInt("MAX_URL_LENGTH", destination.DefaultMaxLength),
+		// Destinations on our own domains would redirect back to us
+		SelfHosts: envList("SHORT_DOMAINS"),
+	})
+	urlOpts = append(urlOpts, service.WithDestinationValidator(dests))
+	checker := loadSafetyCheckers()
+	if len(checker) > 0 {
+		urlOpts = append(urlOpts, service.WithSafetyChecker(checker, service.SafetyPolicy{
+			Quarantine:      os.Getenv("SAFETY_ACTION") == "quarantine",
+			CheckOnRedirect: envBool("SAFETY_CHECK_ON_REDIRECT", false),
+		}))
+	}
+	// Filled from the router and word lists below, before the server starts
+	reservedWords := reserved.New()
+	urlOpts = append(urlOpts, service.WithReservedWords(reservedWords))
+	unlockPolicy := service.UnlockPolicy{
+		TokenTTL:      envDuration("LINK_UNLOCK_TTL", service.DefaultUnlockPolicy.TokenTTL),
+		MaxFailures:   envInt("LINK_UNLOCK_MAX_FAILURES", service.DefaultUnlockPolicy.MaxFailures),
+		FailureWindow: envDuration("LINK_UNLOCK_FAILURE_WINDOW", service.DefaultUnlockPolicy.FailureWindow),
+	}
+	switch unlockSecret := os.Getenv("LINK_UNLOCK_SECRET"); {
+	case unlockSecret == "":
+		log.Print("LINK_UNLOCK_SECRET is not set; password-protected links can't be unlocked")
+	case len(unlockSecret) < 32:
+		log.Fatal("LINK_UNLOCK_SECRET must be at least 32 random bytes")
+	default:
+		unlockPolicy.Secret = []byte(unlockSecret)
+	}
+	urlOpts = append(urlOpts, service.WithUnlockPolicy(unlockPolicy))
+	if comingSoon := os.Getenv("COMING_SOON_URL"); comingSoon != "" {
+		comingSoon, err := dests.Normalize(comingSoon)
+		if err != nil {
+			log.Fatalf("invalid COMING_SOON_URL: %v", err)
+		}
+		if verdict, err := checker.Check(comingSoon); err != nil {
+			log.Printf("could not screen COMING_SOON_URL: %v", err)
+		} else if verdict.Unsafe {
+			log.Fatalf("COMING_SOON_URL is flagged as unsafe: %s", verdict.Reason)
+		}
+		urlOpts = append(urlOpts, service.WithComingSoonURL(comingSoon))
+	}
+	urlOpts = append(urlOpts, service.WithPermanentRedirectMaxAge(envDuration("PERMANENT_REDIRECT_MAX_AGE", service.DefaultPermanentRedirectMaxAge)))
+	urlOpts = append(urlOpts, service.WithDeletionRetention(envDuration("DELETED_LINK_RETENTION", service.DefaultDeletionRetention)))
 	userRepo := repository.NewUserRepository(db)
+	urlOpts = append(urlOpts, service.WithLinkDefaults(userRepo))
+	urlOpts = append(urlOpts, service.WithRedirectRules(repository.NewRuleRepository(db)))
+	urlOpts = append(urlOpts, service.WithVariants(repository.NewVariantRepository(db)))
+	urlService := service.NewURLService(urlRepo, clickRepo, urlOpts...)
+	go purgeDeletedLinks(ctx, urlService, envDuration("DELETED_LINK_PURGE_INTERVAL", time.Hour))
+	urlHandler := api.NewURLHandler(urlService)
+
 	userService := service.NewUserService(userRepo)
 	userHandler := api.NewUserHandler(userService, urlService)
 
+	trustedProxies, err := middleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	r := chi.NewRouter()
 	// Register middleware before routes
+	r.Use(middleware.RequestID)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"}, // allow all origins
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"}, // allow all headers
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", middleware.RequestIDHeader},
 		AllowCredentials: false,
 		MaxAge:           300, // preflight cache duration
 	}))
+	r.Use(middleware.ClientIP(trustedProxies))
+	r.NotFound(api.NotFound)
+	r.MethodNotAllowed(api.MethodNotAllowed)
 	// Swagger UI
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
-	r.Post("/shorten", urlHandler.ShortenURL)
+	r.With(middleware.OptionalAuth).Post("/shorten", urlHandler.ShortenURL)
 	r.Get("/{shortURL}", urlHandler.RedirectURL)
+	r.Post("/{shortURL}", urlHandler.UnlockURL)
+	r.Get("/{shortURL}/*", urlHandler.RedirectURL)
+	r.Post("/{shortURL}/*", urlHandler.UnlockURL)
 	r.Get("/stats/{shortURL}", urlHandler.StatsURL)
 
 	r.Post("/register", userHandler.Register)
 	r.Post("/login", userHandler.Login)
 	r.With(middleware.AuthMiddleware).Get("/user/urls", userHandler.GetUserURLs)
+	r.With(middleware.AuthMiddleware).Get("/user/link-defaults", userHandler.GetLinkDefaults)
+	r.With(middleware.AuthMiddleware).Put("/user/link-defaults", userHandler.SetLinkDefaults)
+	r.With(middleware.AuthMiddleware).Patch("/urls/{id}", urlHandler.UpdateURL)
+	r.With(middleware.AuthMiddleware).Delete("/urls/{id}", urlHandler.DeleteURL)
+	r.With(middleware.AuthMiddleware).Post("/urls/{id}/restore", urlHandler.RestoreURL)
+	r.With(middleware.AuthMiddleware).Get("/urls/{id}/rules", urlHandler.ListRules)
+	r.With(middleware.AuthMiddleware).Post("/urls/{id}/rules", urlHandler.AddRule)
+	r.With(middleware.AuthMiddleware).Put("/urls/{id}/rules/{ruleID}", urlHandler.UpdateRule)
+	r.With(middleware.AuthMiddleware).Delete("/urls/{id}/rules/{ruleID}", urlHandler.DeleteRule)
+	r.With(middleware.AuthMiddleware).Get("/urls/{id}/variants", urlHandler.ListVariants)
+	r.With(middleware.AuthMiddleware).Post("/urls/{id}/variants", urlHandler.AddVariant)
+	r.With(middleware.AuthMiddleware).Put("/urls/{id}/variants/{variantID}", urlHandler.UpdateVariant)
+	r.With(middleware.AuthMiddleware).Delete("/urls/{id}/variants/{variantID}", urlHandler.DeleteVariant)
+
+	if err := reservedWords.ReserveRoutes(r); err != nil {
+		log.Fatalf("failed to reserve route names: %v", err)
+	}
+	if words, err := reserved.LoadFile(envString("RESERVED_ALIASES_FILE", "config/reserved_aliases.txt")); err != nil {
+		log.Printf("reserved alias list not loaded: %v", err)
+	} else {
+		reservedWords.Reserve(words...)
+	}
+	if path := os.Getenv("BLOCKED_WORDS_FILE"); path != "" {
+		words, err := reserved.LoadFile(path)
+		if err != nil {
+			log.Fatalf("failed to load BLOCKED_WORDS_FILE: %v", err)
+		}
+		reservedWords.Block(words...)
+	}
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		fmt.Println("Server is running on port 8080")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	// Runtime metrics, including url_cache hit/miss counters, expose process details, so they are
+	// only served on an internal address such as 127.0.0.1:6060, and not at all by default
+	var debugSrv *http.Server
+	if addr := os.Getenv("DEBUG_ADDR"); addr != "" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/vars", expvar.Handler())
+		debugSrv = &http.Server{Addr: addr, Handler: debug}
+		go func() {
+			if err := debugSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("debug server failed: %v", err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	fmt.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown: %v", err)
+	}
+	if debugSrv != nil {
+		debugSrv.Close()
+	}
+	// Redirects are finished, so every pending click is in the queue. Draining gets its own
+	// deadline, so slow connections during HTTP shutdown don't use it up.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelDrain()
+	if err := clickRecorder.Close(drainCtx); err != nil {
+		log.Printf("failed to drain click queue: %v", err)
+	}
+}
+
+// purgeDeletedLinks periodically hard-deletes links past their restore window
+func purgeDeletedLinks(ctx context.Context, urlService domain.URLService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := urlService.PurgeDeletedLinks()
+			if err != nil {
+				log.Printf("failed to purge deleted links: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d deleted links", n)
+			}
+		}
+	}
+}
+
+// envInt reads an integer setting, using def when unset or invalid
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// loadSafetyCheckers builds the destination checks from the configured list files
+func loadSafetyCheckers() safety.Checkers {
+	var checkers safety.Checkers
+	if path := os.Getenv("SAFETY_BLOCKLIST_FILE"); path != "" {
+		list, err := safety.LoadDomainBlocklist(path)
+		if err != nil {
+			log.Fatalf("failed to load SAFETY_BLOCKLIST_FILE: %v", err)
+		}
+		checkers = append(checkers, list)
+	}
+	if path := os.Getenv("SAFETY_DENYLIST_FILE"); path != "" {
+		list, err := safety.LoadRegexDenylist(path)
+		if err != nil {
+			log.Fatalf("failed to load SAFETY_DENYLIST_FILE: %v", err)
+		}
+		checkers = append(checkers, list)
+	}
+	if path := os.Getenv("SAFETY_HASH_PREFIX_FILE"); path != "" {
+		list, err := safety.LoadHashPrefixList(path)
+		if err != nil {
+			log.Fatalf("failed to load SAFETY_HASH_PREFIX_FILE: %v", err)
+		}
+		checkers = append(checkers, list)
+	}
+	return checkers
+}
+
+// envBool reads a boolean setting such as "true" or "1", using def when unset or invalid
+func envBool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envString reads a string setting, using def when unset
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList reads a comma-separated setting, skipping empty entries
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
 
-	fmt.Println("Server is running on port 8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+// envDuration reads a duration setting such as "500ms", using def when unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
 	}
+	return def
 }
@@ -11,12 +11,15 @@ import (
 func ConfigDB(localhost, dbUser, dbPassword, dbName, dbPort string) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai",
 		localhost, dbUser, dbPassword, dbName, dbPort)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// lets repositories recognise unique violations as gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		log.Fatal("Can't connect to the database")
 	}
 
-	if err := db.AutoMigrate(&model.User{}, &model.URL{}); err != nil {
+	if err := db.AutoMigrate(&model.User{}, &model.URL{}, &model.Click{}, &model.Sequence{}, &model.RedirectRule{}, &model.LinkVariant{}); err != nil {
 		log.Fatal("failed to migrate database:", err)
 	}
 
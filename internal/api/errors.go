@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/middleware"
+)
+
+// Stable machine-readable error codes returned in ErrorResponse.Code
+const (
+	CodeNotFound           = "not_found"
+	CodeExpired            = "link_expired"
+	CodeClickLimit         = "click_limit_reached"
+	CodeDeleted            = "link_deleted"
+	CodeNotActive          = "link_scheduled"
+	CodeAliasTaken         = "alias_taken"
+	CodeAliasReserved      = "alias_reserved"
+	CodeUsernameTaken      = "username_taken"
+	CodeConflict           = "conflict"
+	CodeInvalidURL         = "invalid_url"
+	CodeUnsafeURL          = "unsafe_url"
+	CodeQuarantined        = "link_quarantined"
+	CodePasswordRequired   = "password_required"
+	CodeTooManyAttempts    = "too_many_attempts"
+	CodeInvalidInput       = "invalid_input"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeUnavailable        = "service_unavailable"
+	CodeInternalError      = "internal_error"
+)
+
+// errorMappings is checked in order, so more specific errors come first
+var errorMappings = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{domain.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{domain.ErrExpired, http.StatusGone, CodeExpired},
+	{domain.ErrClickLimit, http.StatusGone, CodeClickLimit},
+	{domain.ErrDeleted, http.StatusGone, CodeDeleted},
+	{domain.ErrNotActive, http.StatusNotFound, CodeNotActive},
+	{domain.ErrAliasTaken, http.StatusConflict, CodeAliasTaken},
+	{domain.ErrAliasReserved, http.StatusBadRequest, CodeAliasReserved},
+	{domain.ErrUsernameTaken, http.StatusConflict, CodeUsernameTaken},
+	{domain.ErrConflict, http.StatusConflict, CodeConflict},
+	{domain.ErrInvalidURL, http.StatusBadRequest, CodeInvalidURL},
+	{domain.ErrUnsafeURL, http.StatusBadRequest, CodeUnsafeURL},
+	{domain.ErrQuarantined, http.StatusForbidden, CodeQuarantined},
+	{domain.ErrPasswordRequired, http.StatusUnauthorized, CodePasswordRequired},
+	{domain.ErrTooManyAttempts, http.StatusTooManyRequests, CodeTooManyAttempts},
+	{domain.ErrInvalidInput, http.StatusBadRequest, CodeInvalidInput},
+	{domain.ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized},
+	{domain.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials},
+	{domain.ErrForbidden, http.StatusForbidden, CodeForbidden},
+	{domain.ErrUnavailable, http.StatusServiceUnavailable, CodeUnavailable},
+}
+
+// writeError maps a service error to its status code and a JSON ErrorResponse.
+// Storage and unexpected errors are logged and reported without internal details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, res := http.StatusInternalServerError, ErrorResponse{Code: CodeInternalError, Message: "internal error"}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			status, res = m.status, ErrorResponse{Code: m.code, Message: err.Error()}
+			break
+		}
+	}
+	var validation *domain.ValidationError
+	if errors.As(err, &validation) {
+		res.Details = map[string]string{}
+		if validation.Field != "" {
+			res.Details["field"] = validation.Field
+		}
+		if validation.Reason != "" {
+			res.Details["reason"] = validation.Reason
+		}
+		if len(res.Details) == 0 {
+			res.Details = nil
+		}
+	}
+	res.RequestID = middleware.RequestIDFromContext(r.Context())
+	switch status {
+	case http.StatusServiceUnavailable:
+		log.Printf("service unavailable [%s]: %v", res.RequestID, err)
+		res.Message = "service temporarily unavailable, please retry"
+	case http.StatusInternalServerError:
+		log.Printf("internal error [%s]: %v", res.RequestID, err)
+	}
+	writeJSON(w, status, res)
+}
+
+// badRequest reports a malformed request; field is echoed in details when set
+func badRequest(w http.ResponseWriter, r *http.Request, field, message string) {
+	writeError(w, r, &domain.ValidationError{Field: field, Message: message})
+}
+
+// writeJSON writes v as the response body. The status line is already sent when encoding
+// fails, so the failure can only be logged.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// NotFound answers unknown routes with the JSON envelope instead of the router's plain text
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, domain.ErrNotFound)
+}
+
+// MethodNotAllowed answers known routes called with the wrong method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{
+		Code:      CodeMethodNotAllowed,
+		Message:   "method not allowed",
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	})
+}
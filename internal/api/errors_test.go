@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteErrorEnvelope(t *testing.T) {
+	cases := []struct {
+		err     error
+		status  int
+		code    string
+		details map[string]string
+	}{
+		{domain.ErrNotFound, http.StatusNotFound, CodeNotFound, nil},
+		{fmt.Errorf("lookup: %w", domain.ErrExpired), http.StatusGone, CodeExpired, nil},
+		{&domain.ValidationError{Field: "max_clicks", Message: "max_clicks must be > 0"}, http.StatusBadRequest, CodeInvalidInput, map[string]string{"field": "max_clicks"}},
+		{&domain.ValidationError{Field: "url", Reason: "scheme_not_allowed", Message: "url scheme javascript is not allowed"}, http.StatusBadRequest, CodeInvalidInput, map[string]string{"field": "url", "reason": "scheme_not_allowed"}},
+		{domain.ErrUsernameTaken, http.StatusConflict, CodeUsernameTaken, nil},
+		{domain.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials, nil},
+		{&domain.StorageError{Err: fmt.Errorf("connection refused")}, http.StatusServiceUnavailable, CodeUnavailable, nil},
+		{fmt.Errorf("boom"), http.StatusInternalServerError, CodeInternalError, nil},
+	}
+	for _, tc := range cases {
+		h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, tc.err)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(middleware.RequestIDHeader, "req-123")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.status, rec.Code, tc.err.Error())
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "req-123", rec.Header().Get(middleware.RequestIDHeader))
+		var res ErrorResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, tc.code, res.Code)
+		assert.Equal(t, tc.details, res.Details)
+		assert.Equal(t, "req-123", res.RequestID)
+		assert.NotContains(t, res.Message, "connection refused")
+	}
+}
+
+func TestRequestIDReplacesMalformedHeader(t *testing.T) {
+	var seen string
+	h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.RequestIDFromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "bad id\r\n")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rec.Header().Get(middleware.RequestIDHeader))
+}
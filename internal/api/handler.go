@@ -2,12 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 	"url-shortener/internal/domain"
 	"url-shortener/internal/middleware"
+	"url-shortener/internal/model"
 	"url-shortener/internal/service"
 )
 
@@ -21,113 +26,859 @@ func NewURLHandler(service domain.URLService) *URLHandler {
 
 // ShortenURL godoc
 // @Summary      Shorten a URL with marketing options
-// @Description  Create a shortened link for the given URL with optional custom alias, expiration, click limit, and UTM parameters
+// @Description  Create a shortened link for the given URL with optional custom alias, expiration, click limit, UTM parameters, redirect type (301, 302, 307, 308 or html; 302 by default), password, activation time and fallback for once it expired or ran out of clicks.
+// @Description  A bearer token is optional; links created with one belong to the caller, and only they may set expired_page.
 // @Tags         urls
 // @Accept       json
 // @Produce      json
 // @Param        request  body   ShortenRequest   true  "Shorten request payload"
 // @Success      200      {object} ShortenResponse
 // @Failure      400      {object} ErrorResponse
+// @Failure      401      {object} ErrorResponse "expired_page without a token, or an invalid token"
+// @Failure      409      {object} ErrorResponse
 // @Failure      500      {object} ErrorResponse
+// @Failure      503      {object} ErrorResponse
 // @Router       /shorten [post]
 func (h *URLHandler) ShortenURL(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		URL         string  `json:"url"`
-		CustomAlias string  `json:"custom_alias,omitempty"`
-		Expiration  string  `json:"expiration,omitempty"`
-		MaxClicks   *uint64 `json:"max_clicks,omitempty"`
-		UTMSource   string  `json:"utm_source,omitempty"`
-		UTMMedium   string  `json:"utm_medium,omitempty"`
-		UTMCampaign string  `json:"utm_campaign,omitempty"`
+		URL           string  `json:"url"`
+		CustomAlias   string  `json:"custom_alias,omitempty"`
+		Expiration    string  `json:"expiration,omitempty"`
+		MaxClicks     *uint64 `json:"max_clicks,omitempty"`
+		UTMSource     string  `json:"utm_source,omitempty"`
+		UTMMedium     string  `json:"utm_medium,omitempty"`
+		UTMCampaign   string  `json:"utm_campaign,omitempty"`
+		RedirectType  string  `json:"redirect_type,omitempty"`
+		Password      string  `json:"password,omitempty"`
+		ActivatesAt   string  `json:"activates_at,omitempty"`
+		ComingSoonURL string  `json:"coming_soon_url,omitempty"`
+		FallbackURL   string  `json:"fallback_url,omitempty"`
+		ExpiredPage   string  `json:"expired_page,omitempty"`
+		// Passthrough of the incoming query string and of path segments after the code
+		QueryPassthrough string `json:"query_passthrough,omitempty"`
+		PathPassthrough  bool   `json:"path_passthrough,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "", "Invalid request body")
 		return
 	}
-	// Validate custom alias format
-	if req.CustomAlias != "" {
-		for _, r := range req.CustomAlias {
-			if !(r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
-				http.Error(w, "custom_alias must be alphanumeric or dash", http.StatusBadRequest)
-				return
-			}
-		}
-		// Check uniqueness
-		if urlObj, err := h.service.GetStats(req.CustomAlias); err == nil && urlObj != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(map[string]string{"error": "custom_alias already taken"})
-			return
-		}
-	}
 	// Parse expiration
 	var expPtr *time.Time
 	if req.Expiration != "" {
 		exp, err := time.Parse(time.RFC3339, req.Expiration)
 		if err != nil || exp.Before(time.Now()) {
-			http.Error(w, "Invalid expiration (must be RFC3339 and in the future)", http.StatusBadRequest)
+			badRequest(w, r, "expiration", "Invalid expiration (must be RFC3339 and in the future)")
 			return
 		}
 		expPtr = &exp
 	}
+	var activatesAt *time.Time
+	if req.ActivatesAt != "" {
+		at, err := time.Parse(time.RFC3339, req.ActivatesAt)
+		if err != nil {
+			badRequest(w, r, "activates_at", "Invalid activates_at (must be RFC3339)")
+			return
+		}
+		activatesAt = &at
+	}
 	// Validate max clicks
 	if req.MaxClicks != nil && *req.MaxClicks == 0 {
-		http.Error(w, "max_clicks must be > 0", http.StatusBadRequest)
+		badRequest(w, r, "max_clicks", "max_clicks must be > 0")
 		return
 	}
 	userID, _ := middleware.UserIDFromContext(r.Context())
-	shortURL, err := h.service.ShortenWithOptions(req.URL, userID, req.CustomAlias, expPtr, req.MaxClicks, req.UTMSource, req.UTMMedium, req.UTMCampaign)
+	shortURL, err := h.service.ShortenLink(domain.ShortenOptions{
+		OriginalURL:      req.URL,
+		UserID:           userID,
+		CustomAlias:      req.CustomAlias,
+		ActivatesAt:      activatesAt,
+		ComingSoonURL:    req.ComingSoonURL,
+		Expiration:       expPtr,
+		FallbackURL:      req.FallbackURL,
+		ExpiredPage:      req.ExpiredPage,
+		MaxClicks:        req.MaxClicks,
+		UTMSource:        req.UTMSource,
+		UTMMedium:        req.UTMMedium,
+		UTMCampaign:      req.UTMCampaign,
+		RedirectType:     req.RedirectType,
+		Password:         req.Password,
+		QueryPassthrough: req.QueryPassthrough,
+		PathPassthrough:  req.PathPassthrough,
+	})
 	if err != nil {
-		if err.Error() == "custom alias already in use" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(map[string]string{"error": "custom_alias already taken"})
-			return
-		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	res := struct {
-		ShortURL string `json:"short_url"`
-	}{ShortURL: shortURL}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, ShortenResponse{ShortURL: shortURL})
 }
 
 // RedirectURL godoc
 // @Summary      Redirect to original URL
-// @Description  Redirects from a shortened token to the original URL and enforces expiration and click limit
+// @Description  Redirects from a shortened token to the original URL and enforces expiration, click limit and deletion; links flagged by a safety check show a warning page first.
+// @Description  The status follows the link's redirect type: 301 and 308 may be cached by clients, 302 and 307 are never cached so every click is counted, and html answers 200 with a page that redirects from the browser.
+// @Description  Links with query passthrough merge the incoming query string into the destination, and links with path passthrough append anything after the code (/abc123/docs/intro) to the destination's path; other links answer 404 for extra path segments.
 // @Tags         urls
 // @Param        shortURL  path   string           true  "Short URL token or custom alias"
+// @Param        proceed   query  string           false "Set to 1 to continue past the warning page"
 // @Success      302      {string} string        "redirect URL"
-// @Failure      404      {object} ErrorResponse
-// @Failure      410      {object} ErrorResponse
+// @Success      301      {string} string        "permanent redirect for links with redirect type 301"
+// @Success      307      {string} string        "temporary redirect for links with redirect type 307"
+// @Success      308      {string} string        "permanent redirect for links with redirect type 308"
+// @Success      200      {string} string        "warning page for quarantined links, or redirect page for links with redirect type html"
+// @Failure      401      {string} string        "password form for protected links; see the POST endpoint"
+// @Failure      404      {object} ErrorResponse "unknown link, or coming soon page before a scheduled link activates"
+// @Failure      410      {object} ErrorResponse "ended link without a fallback; with a fallback URL it redirects there (302) and with a custom expiry page it serves that page (410)"
+// @Failure      503      {object} ErrorResponse
 // @Router       /{shortURL} [get]
 func (h *URLHandler) RedirectURL(w http.ResponseWriter, r *http.Request) {
 	shortURL := chi.URLParam(r, "shortURL")
-	originalURL, err := h.service.Redirect(shortURL)
+	if strings.HasSuffix(shortURL, "+") || r.URL.Query().Get("preview") == "1" {
+		h.PreviewURL(w, r)
+		return
+	}
+	visit := visitFromRequest(r)
+	target, err := h.service.Follow(shortURL, visit)
+	if renderUnavailable(w, r, err) {
+		return
+	}
+	var quarantined *domain.QuarantineError
+	if errors.As(err, &quarantined) {
+		renderPage(w, http.StatusOK, interstitialPage, interstitialData{
+			Destination: quarantined.Destination,
+			Reason:      quarantined.Reason,
+			ProceedURL:  proceedURL(shortURL, r),
+		})
+		return
+	}
+	var preview *domain.PreviewError
+	if errors.As(err, &preview) {
+		renderPage(w, http.StatusOK, previewPage, newPreviewData(preview.Link, shortURL, r))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Whoever unlocked the link may see where it goes; shared caches must not remember it
+	if visit.UnlockToken != "" {
+		target.MaxAge = 0
+	}
+	// New visitors keep the ID their variant was picked for, so they stay on it
+	if visit.VisitorID == "" && target.VisitorID != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     visitorCookie,
+			Value:    target.VisitorID,
+			Path:     "/",
+			MaxAge:   int(visitorCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	redirect(w, r, target)
+}
+
+// visitorCookie keeps a visitor on the same A/B variant of every link they follow
+const visitorCookie = "visitor_id"
+
+const visitorCookieMaxAge = 365 * 24 * time.Hour
+
+// renderUnavailable answers for links that can't be followed by this visitor: protected links ask
+// for their password, scheduled ones say they're coming soon and ended ones go to their fallback,
+// if they have one. It reports whether it did.
+func renderUnavailable(w http.ResponseWriter, r *http.Request, err error) bool {
+	var locked *domain.PasswordError
+	if errors.As(err, &locked) {
+		renderPage(w, http.StatusUnauthorized, unlockPage, unlockData{Title: locked.Link.Title, Action: r.URL.RequestURI()})
+		return true
+	}
+	var ended *domain.EndedError
+	if errors.As(err, &ended) && (ended.FallbackURL != "" || ended.Page != "") {
+		if ended.FallbackURL != "" {
+			w.Header().Set("Cache-Control", "private, no-store")
+			http.Redirect(w, r, ended.FallbackURL, http.StatusFound)
+			return true
+		}
+		renderCustomPage(w, http.StatusGone, ended.Page)
+		return true
+	}
+	var scheduled *domain.ScheduledError
+	if errors.As(err, &scheduled) {
+		if scheduled.ComingSoonURL != "" {
+			w.Header().Set("Cache-Control", "private, no-store")
+			http.Redirect(w, r, scheduled.ComingSoonURL, http.StatusFound)
+			return true
+		}
+		renderPage(w, http.StatusNotFound, comingSoonPage, comingSoonData{ActivatesAt: scheduled.ActivatesAt})
+		return true
+	}
+	return false
+}
+
+// redirect sends the visitor on the way target asks for, with caching to match: only permanent
+// redirects may be cached, everything else must reach us again so the click is counted
+func redirect(w http.ResponseWriter, r *http.Request, target *domain.RedirectTarget) {
+	if target.Type == domain.RedirectHTML {
+		renderPage(w, http.StatusOK, redirectPage, redirectData{Destination: target.URL})
+		return
+	}
+	status := http.StatusFound
+	switch target.Type {
+	case domain.RedirectMovedPermanently:
+		status = http.StatusMovedPermanently
+	case domain.RedirectTemporary:
+		status = http.StatusTemporaryRedirect
+	case domain.RedirectPermanent:
+		status = http.StatusPermanentRedirect
+	}
+	if target.MaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(target.MaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	http.Redirect(w, r, target.URL, status)
+}
+
+// PreviewURL godoc
+// @Summary      Preview a short link
+// @Description  Shows the destination, creation date, click count and title of a link as an HTML page instead of redirecting; reached with a + suffix (/abc123+) or preview=1
+// @Tags         urls
+// @Produce      html
+// @Param        shortURL  path   string  true   "Short URL token or custom alias, optionally followed by +"
+// @Param        preview   query  string  false  "Set to 1 to preview"
+// @Success      200      {string} string  "preview page"
+// @Failure      404      {object} ErrorResponse
+// @Failure      410      {object} ErrorResponse
+// @Router       /{shortURL}+ [get]
+func (h *URLHandler) PreviewURL(w http.ResponseWriter, r *http.Request) {
+	shortURL := strings.TrimSuffix(chi.URLParam(r, "shortURL"), "+")
+	urlObj, err := h.service.Preview(shortURL, visitFromRequest(r))
+	if renderUnavailable(w, r, err) {
+		return
+	}
 	if err != nil {
-		if err.Error() == "link expired" || err.Error() == "click limit reached" {
-			http.Error(w, err.Error(), http.StatusGone)
-		} else {
-			http.Error(w, "URL not found", http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+	renderPage(w, http.StatusOK, previewPage, newPreviewData(urlObj, shortURL, r))
+}
+
+// UnlockURL godoc
+// @Summary      Unlock a password-protected link
+// @Description  Checks the password submitted by the unlock form. On success a short-lived cookie keeps the link unlocked and the visitor is sent back to it; wrong passwords show the form again and are rate-limited per link and client.
+// @Tags         urls
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        shortURL  path      string  true  "Short URL token or custom alias"
+// @Param        password  formData  string  true  "Link password"
+// @Success      303      {string} string  "back to the link"
+// @Failure      401      {string} string  "form again after a wrong password"
+// @Failure      404      {object} ErrorResponse
+// @Failure      410      {object} ErrorResponse
+// @Failure      429      {string} string  "form again after too many wrong passwords"
+// @Router       /{shortURL} [post]
+func (h *URLHandler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	shortURL := strings.TrimSuffix(chi.URLParam(r, "shortURL"), "+")
+	token, err := h.service.Unlock(shortURL, r.PostFormValue("password"), middleware.ClientIPFromContext(r))
+	switch {
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		renderPage(w, http.StatusUnauthorized, unlockPage, unlockData{Action: r.URL.RequestURI(), Error: "Wrong password, please try again."})
+		return
+	case errors.Is(err, domain.ErrTooManyAttempts):
+		renderPage(w, http.StatusTooManyRequests, unlockPage, unlockData{Action: r.URL.RequestURI(), Error: "Too many wrong passwords. Please try again later."})
+		return
+	case err != nil:
+		writeError(w, r, err)
+		return
+	}
+	// The token carries its own expiry; the cookie only lives for the browser session
+	linkPath := "/" + url.PathEscape(shortURL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookie,
+		Value:    token,
+		Path:     linkPath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// The cookie isn't sent to /code+, so previews continue on /code?preview=1
+	back := linkPath + escapedExtraPath(r)
+	q := r.URL.Query()
+	if strings.HasSuffix(chi.URLParam(r, "shortURL"), "+") {
+		q.Set("preview", "1")
+	}
+	if len(q) > 0 {
+		back += "?" + q.Encode()
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// unlockCookie holds the token of an unlocked link, scoped to the link's path
+const unlockCookie = "link_unlock"
+
+func newPreviewData(urlObj *model.URL, shortURL string, r *http.Request) previewData {
+	return previewData{
+		Title:       urlObj.Title,
+		Destination: urlObj.OriginalURL,
+		CreatedAt:   urlObj.CreatedAt,
+		ClickCount:  urlObj.ClickCount,
+		Warning:     urlObj.QuarantineReason,
+		ProceedURL:  proceedURL(shortURL, r),
+	}
+}
+
+// proceedURL links back to the short link, past any warning or preview page, keeping other query parameters
+func proceedURL(shortURL string, r *http.Request) string {
+	q := r.URL.Query()
+	q.Del("preview")
+	q.Set("proceed", "1")
+	return "/" + url.PathEscape(shortURL) + escapedExtraPath(r) + "?" + q.Encode()
+}
+
+// extraPath returns the unescaped path after the code of a /{shortURL}/* request
+func extraPath(r *http.Request) string {
+	rest := chi.URLParam(r, "*")
+	// The router matches the escaped path when the request has one
+	if r.URL.RawPath != "" {
+		if unescaped, err := url.PathUnescape(rest); err == nil {
+			rest = unescaped
 		}
+	}
+	return rest
+}
+
+// escapedExtraPath is extraPath ready to be put back after the code, with its leading slash
+func escapedExtraPath(r *http.Request) string {
+	rest := extraPath(r)
+	if rest == "" {
+		return ""
+	}
+	return "/" + (&url.URL{Path: rest}).EscapedPath()
+}
+
+// UpdateURL godoc
+// @Summary      Update a link
+// @Description  Changes the destination, alias, expiration, click limit, UTM parameters, preview title, forced preview, redirect type, password, activation time, fallback or passthrough of a link owned by the caller; omitted fields are unchanged and null clears activates_at, expiration or max_clicks
+// @Tags         urls
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path   int                true  "Link ID"
+// @Param        request  body   UpdateLinkRequest  true  "Fields to change"
+// @Success      200      {object} model.URL
+// @Failure      400      {object} ErrorResponse
+// @Failure      401      {object} ErrorResponse
+// @Failure      403      {object} ErrorResponse
+// @Failure      404      {object} ErrorResponse
+// @Failure      409      {object} ErrorResponse
+// @Router       /urls/{id} [patch]
+func (h *URLHandler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, r, domain.ErrUnauthorized)
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "id", "Invalid link id")
+		return
+	}
+	update, err := parseLinkUpdate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	urlObj, err := h.service.UpdateLink(uint(id), userID, update)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, urlObj)
+}
+
+// DeleteURL godoc
+// @Summary      Delete a link
+// @Description  Soft-deletes a link owned by the caller; it answers 410 until restored or purged after the retention window
+// @Tags         urls
+// @Security     ApiKeyAuth
+// @Param        id   path  int  true  "Link ID"
+// @Success      204
+// @Failure      401  {object} ErrorResponse
+// @Failure      403  {object} ErrorResponse
+// @Failure      404  {object} ErrorResponse
+// @Router       /urls/{id} [delete]
+func (h *URLHandler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, r, domain.ErrUnauthorized)
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "id", "Invalid link id")
+		return
+	}
+	if err := h.service.DeleteLink(uint(id), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreURL godoc
+// @Summary      Restore a deleted link
+// @Description  Undoes a soft delete while the link is within the retention window
+// @Tags         urls
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path  int  true  "Link ID"
+// @Success      200  {object} model.URL
+// @Failure      401  {object} ErrorResponse
+// @Failure      403  {object} ErrorResponse
+// @Failure      404  {object} ErrorResponse
+// @Failure      410  {object} ErrorResponse
+// @Router       /urls/{id}/restore [post]
+func (h *URLHandler) RestoreURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, r, domain.ErrUnauthorized)
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "id", "Invalid link id")
+		return
+	}
+	urlObj, err := h.service.RestoreLink(uint(id), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, urlObj)
+}
+
+// ListRules godoc
+// @Summary      List the redirect rules of a link
+// @Description  Returns the routing rules of a link owned by the caller in the order they are tried; visitors matching none go to the link's own destination
+// @Tags         urls
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path  int  true  "Link ID"
+// @Success      200  {array}  model.RedirectRule
+// @Failure      401  {object} ErrorResponse
+// @Failure      403  {object} ErrorResponse
+// @Failure      404  {object} ErrorResponse
+// @Router       /urls/{id}/rules [get]
+func (h *URLHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	rules, err := h.service.ListRules(linkID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// AddRule godoc
+// @Summary      Add a redirect rule
+// @Description  Adds a routing rule by device, operating system, preferred language, country, time of day or date range to a link owned by the caller
+// @Tags         urls
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path   int                  true  "Link ID"
+// @Param        request  body   RedirectRuleRequest  true  "Rule"
+// @Success      201      {object} model.RedirectRule
+// @Failure      400      {object} ErrorResponse
+// @Failure      401      {object} ErrorResponse
+// @Failure      403      {object} ErrorResponse
+// @Failure      404      {object} ErrorResponse
+// @Router       /urls/{id}/rules [post]
+func (h *URLHandler) AddRule(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	created, err := h.service.AddRule(linkID, userID, rule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// UpdateRule godoc
+// @Summary      Replace a redirect rule
+// @Description  Replaces a routing rule of a link owned by the caller; an omitted position keeps the rule where it is
+// @Tags         urls
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path   int                  true  "Link ID"
+// @Param        ruleID   path   int                  true  "Rule ID"
+// @Param        request  body   RedirectRuleRequest  true  "Rule"
+// @Success      200      {object} model.RedirectRule
+// @Failure      400      {object} ErrorResponse
+// @Failure      401      {object} ErrorResponse
+// @Failure      403      {object} ErrorResponse
+// @Failure      404      {object} ErrorResponse
+// @Router       /urls/{id}/rules/{ruleID} [put]
+func (h *URLHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseUint(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "ruleID", "Invalid rule id")
+		return
+	}
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	updated, err := h.service.UpdateRule(linkID, uint(ruleID), userID, rule)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	http.Redirect(w, r, originalURL, http.StatusFound)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteRule godoc
+// @Summary      Delete a redirect rule
+// @Description  Removes a routing rule from a link owned by the caller
+// @Tags         urls
+// @Security     ApiKeyAuth
+// @Param        id      path  int  true  "Link ID"
+// @Param        ruleID  path  int  true  "Rule ID"
+// @Success      204
+// @Failure      401  {object} ErrorResponse
+// @Failure      403  {object} ErrorResponse
+// @Failure      404  {object} ErrorResponse
+// @Router       /urls/{id}/rules/{ruleID} [delete]
+func (h *URLHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseUint(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "ruleID", "Invalid rule id")
+		return
+	}
+	if err := h.service.DeleteRule(linkID, uint(ruleID), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListVariants godoc
+// @Summary      List A/B variants
+// @Description  Returns the weighted destinations visitors of a link owned by the caller are split over
+// @Tags         urls
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path  int  true  "Link ID"
+// @Success      200  {array}  model.LinkVariant
+// @Failure      401  {object} ErrorResponse
+// @Failure      403  {object} ErrorResponse
+// @Failure      404  {object} ErrorResponse
+// @Router       /urls/{id}/variants [get]
+func (h *URLHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	variants, err := h.service.ListVariants(linkID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, variants)
+}
+
+// AddVariant godoc
+// @Summary      Add an A/B variant
+// @Description  Adds a weighted destination to a link owned by the caller. Visitors not routed by a rule are split over the variants by weight and keep getting the same one.
+// @Tags         urls
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path   int                 true  "Link ID"
+// @Param        request  body   LinkVariantRequest  true  "Variant"
+// @Success      201      {object} model.LinkVariant
+// @Failure      400      {object} ErrorResponse
+// @Failure      401      {object} ErrorResponse
+// @Failure      403      {object} ErrorResponse
+// @Failure      404      {object} ErrorResponse
+// @Router       /urls/{id}/variants [post]
+func (h *URLHandler) AddVariant(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	variant, ok := decodeVariant(w, r)
+	if !ok {
+		return
+	}
+	created, err := h.service.AddVariant(linkID, userID, variant)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// UpdateVariant godoc
+// @Summary      Replace an A/B variant
+// @Description  Replaces the label, destination and weight of a variant of a link owned by the caller
+// @Tags         urls
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id         path   int                 true  "Link ID"
+// @Param        variantID  path   int                 true  "Variant ID"
+// @Param        request    body   LinkVariantRequest  true  "Variant"
+// @Success      200        {object} model.LinkVariant
+// @Failure      400        {object} ErrorResponse
+// @Failure      401        {object} ErrorResponse
+// @Failure      403        {object} ErrorResponse
+// @Failure      404        {object} ErrorResponse
+// @Router       /urls/{id}/variants/{variantID} [put]
+func (h *URLHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	variantID, err := strconv.ParseUint(chi.URLParam(r, "variantID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "variantID", "Invalid variant id")
+		return
+	}
+	variant, ok := decodeVariant(w, r)
+	if !ok {
+		return
+	}
+	updated, err := h.service.UpdateVariant(linkID, uint(variantID), userID, variant)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteVariant godoc
+// @Summary      Delete an A/B variant
+// @Description  Removes a variant from a link owned by the caller; its recorded clicks are kept
+// @Tags         urls
+// @Security     ApiKeyAuth
+// @Param        id         path  int  true  "Link ID"
+// @Param        variantID  path  int  true  "Variant ID"
+// @Success      204
+// @Failure      401  {object} ErrorResponse
+// @Failure      403  {object} ErrorResponse
+// @Failure      404  {object} ErrorResponse
+// @Router       /urls/{id}/variants/{variantID} [delete]
+func (h *URLHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	userID, linkID, ok := linkFromRequest(w, r)
+	if !ok {
+		return
+	}
+	variantID, err := strconv.ParseUint(chi.URLParam(r, "variantID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "variantID", "Invalid variant id")
+		return
+	}
+	if err := h.service.DeleteVariant(linkID, uint(variantID), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeVariant(w http.ResponseWriter, r *http.Request) (model.LinkVariant, bool) {
+	var req LinkVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "", "Invalid request body")
+		return model.LinkVariant{}, false
+	}
+	return model.LinkVariant{Label: req.Label, Destination: req.Destination, Weight: req.Weight}, true
+}
+
+// linkFromRequest reads the caller and the link ID of a /urls/{id}/... request, answering the
+// request itself when either is missing
+func linkFromRequest(w http.ResponseWriter, r *http.Request) (userID, linkID uint, ok bool) {
+	userID, ok = middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, r, domain.ErrUnauthorized)
+		return 0, 0, false
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "id", "Invalid link id")
+		return 0, 0, false
+	}
+	return userID, uint(id), true
+}
+
+func decodeRule(w http.ResponseWriter, r *http.Request) (model.RedirectRule, bool) {
+	var req RedirectRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "", "Invalid request body")
+		return model.RedirectRule{}, false
+	}
+	return model.RedirectRule{
+		Destination: req.Destination,
+		Position:    req.Position,
+		Devices:     req.Devices,
+		OS:          req.OS,
+		Languages:   req.Languages,
+		Countries:   req.Countries,
+		TimeFrom:    req.TimeFrom,
+		TimeTo:      req.TimeTo,
+		TimeZone:    req.TimeZone,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+	}, true
+}
+
+// parseLinkUpdate decodes a PATCH body, telling omitted fields apart from explicit nulls
+func parseLinkUpdate(r *http.Request) (domain.LinkUpdate, error) {
+	var update domain.LinkUpdate
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		return update, &domain.ValidationError{Message: "Invalid request body"}
+	}
+	isNull := func(raw json.RawMessage) bool { return string(raw) == "null" }
+	for key, raw := range fields {
+		var err error
+		switch key {
+		case "url":
+			err = json.Unmarshal(raw, &update.OriginalURL)
+		case "custom_alias":
+			err = json.Unmarshal(raw, &update.CustomAlias)
+		case "utm_source":
+			err = json.Unmarshal(raw, &update.UTMSource)
+		case "utm_medium":
+			err = json.Unmarshal(raw, &update.UTMMedium)
+		case "utm_campaign":
+			err = json.Unmarshal(raw, &update.UTMCampaign)
+		case "title":
+			err = json.Unmarshal(raw, &update.Title)
+		case "force_preview":
+			err = json.Unmarshal(raw, &update.ForcePreview)
+		case "redirect_type":
+			err = json.Unmarshal(raw, &update.RedirectType)
+		case "query_passthrough":
+			err = json.Unmarshal(raw, &update.QueryPassthrough)
+		case "path_passthrough":
+			err = json.Unmarshal(raw, &update.PathPassthrough)
+		case "coming_soon_url":
+			err = json.Unmarshal(raw, &update.ComingSoonURL)
+		case "fallback_url":
+			err = json.Unmarshal(raw, &update.FallbackURL)
+		case "expired_page":
+			err = json.Unmarshal(raw, &update.ExpiredPage)
+		case "activates_at":
+			if isNull(raw) {
+				update.ClearActivatesAt = true
+				break
+			}
+			var v string
+			if err = json.Unmarshal(raw, &v); err == nil {
+				var at time.Time
+				if at, err = time.Parse(time.RFC3339, v); err == nil {
+					update.ActivatesAt = &at
+				}
+			}
+			if err != nil {
+				return update, &domain.ValidationError{Field: key, Message: "Invalid activates_at (must be RFC3339)"}
+			}
+		case "password":
+			err = json.Unmarshal(raw, &update.Password)
+		case "max_clicks":
+			if isNull(raw) {
+				update.ClearMaxClicks = true
+			} else {
+				err = json.Unmarshal(raw, &update.MaxClicks)
+			}
+		case "expiration":
+			if isNull(raw) {
+				update.ClearExpiration = true
+				break
+			}
+			var v string
+			if err = json.Unmarshal(raw, &v); err == nil {
+				var exp time.Time
+				if exp, err = time.Parse(time.RFC3339, v); err == nil {
+					update.Expiration = &exp
+				}
+			}
+			if err != nil {
+				return update, &domain.ValidationError{Field: key, Message: "Invalid expiration (must be RFC3339 and in the future)"}
+			}
+		default:
+			return update, &domain.ValidationError{Field: key, Message: "unknown field " + key}
+		}
+		if err != nil {
+			return update, &domain.ValidationError{Field: key, Message: "invalid value for " + key}
+		}
+	}
+	return update, nil
+}
+
+// visitFromRequest collects the click details recorded for a redirect
+func visitFromRequest(r *http.Request) domain.Visit {
+	return domain.Visit{
+		Referrer:       r.Referer(),
+		UserAgent:      r.UserAgent(),
+		IP:             middleware.ClientIPFromContext(r),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Proceed:        r.URL.Query().Get("proceed") == "1",
+		UnlockToken:    unlockToken(r),
+		VisitorID:      visitorID(r),
+		Query:          r.URL.RawQuery,
+		ExtraPath:      extraPath(r),
+	}
+}
+
+func visitorID(r *http.Request) string {
+	if c, err := r.Cookie(visitorCookie); err == nil && len(c.Value) <= 64 {
+		return c.Value
+	}
+	return ""
+}
+
+func unlockToken(r *http.Request) string {
+	if c, err := r.Cookie(unlockCookie); err == nil {
+		return c.Value
+	}
+	return ""
 }
 
 // StatsURL godoc
 // @Summary      Get click statistics
-// @Description  Returns click count and last click date for a shortened URL or alias
+// @Description  Returns click count, last click date and referrer/device/browser/OS/geography breakdowns for a shortened URL or alias; pass interval to add a bucketed click time-series
 // @Tags         urls
 // @Produce      json
-// @Param        shortURL  path   string        true  "Short URL token or alias"
+// @Param        shortURL  path   string        true   "Short URL token or alias"
+// @Param        interval  query  string        false  "Bucket size"  Enums(hour, day, week, month)
+// @Param        from      query  string        false  "Range start (RFC3339), defaults to 30 days before to"
+// @Param        to        query  string        false  "Range end (RFC3339), defaults to now"
+// @Param        tz        query  string        false  "IANA time zone used for bucket boundaries, defaults to UTC"
 // @Success      200      {object} StatsResponse
+// @Failure      400      {object} ErrorResponse
 // @Failure      404      {object} ErrorResponse
+// @Failure      503      {object} ErrorResponse
 // @Router       /stats/{shortURL} [get]
 func (h *URLHandler) StatsURL(w http.ResponseWriter, r *http.Request) {
 	shortURL := chi.URLParam(r, "shortURL")
@@ -136,31 +887,124 @@ func (h *URLHandler) StatsURL(w http.ResponseWriter, r *http.Request) {
 		// If URL is longer than expected, it might be URL encoded
 		// Extract just the token part
 		if strings.Contains(shortURL, "%") {
-			http.Error(w, "Invalid short URL format. Use only the token (e.g., 'qIhf8TFq')", http.StatusBadRequest)
+			badRequest(w, r, "shortURL", "Invalid short URL format. Use only the token (e.g., 'qIhf8TFq')")
 			return
 		}
 	}
 
 	urlObj, err := h.service.GetStats(shortURL)
 	if err != nil {
-		http.Error(w, "Statistics not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-	res := struct {
-		ShortURL      string     `json:"short_url"`
-		OriginalURL   string     `json:"original_url"`
-		ClickCount    uint64     `json:"click_count"`
-		LastClickedAt *time.Time `json:"last_clicked_at"`
-	}{
+	res := StatsResponse{
 		ShortURL:      urlObj.ShortenedURL,
-		OriginalURL:   urlObj.OriginalURL,
+		OriginalURL:   statsDestination(urlObj),
 		ClickCount:    urlObj.ClickCount,
 		LastClickedAt: urlObj.LastClickedAt,
+		State:         urlObj.StateAt(time.Now()),
+		ActivatesAt:   urlObj.ActivatesAt,
+		Expiration:    urlObj.Expiration,
+	}
+	breakdowns, err := h.service.GetBreakdowns(shortURL)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res.Breakdowns = &StatsBreakdowns{
+		Referrers: toBreakdownItems(breakdowns.Referrers),
+		Devices:   toBreakdownItems(breakdowns.Devices),
+		Browsers:  toBreakdownItems(breakdowns.Browsers),
+		OS:        toBreakdownItems(breakdowns.OS),
+		Countries: toBreakdownItems(breakdowns.Countries),
+		Cities:    toBreakdownItems(breakdowns.Cities),
+	}
+	variants, err := h.service.GetVariantStats(shortURL)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for _, v := range variants {
+		item := StatsVariant{
+			ID:            v.Variant.ID,
+			Label:         v.Variant.Label,
+			Destination:   v.Variant.Destination,
+			Weight:        v.Variant.Weight,
+			WeightPercent: v.WeightPercent,
+			Clicks:        v.Clicks,
+			ClickPercent:  v.ClickPercent,
+		}
+		if urlObj.HasPassword() {
+			item.Destination = ""
+		}
+		res.Variants = append(res.Variants, item)
+	}
+	// Time-series mode
+	if interval := r.URL.Query().Get("interval"); interval != "" {
+		from, to, loc, err := parseSeriesRange(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		buckets, err := h.service.GetClickSeries(shortURL, interval, from, to, loc)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		res.Interval = interval
+		res.TimeZone = loc.String()
+		res.Series = make([]StatsBucket, 0, len(buckets))
+		for _, b := range buckets {
+			res.Series = append(res.Series, StatsBucket{Start: b.Start, Count: b.Count})
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// statsDestination keeps the destination of password-protected links out of public stats
+func statsDestination(urlObj *model.URL) string {
+	if urlObj.HasPassword() {
+		return ""
+	}
+	return urlObj.OriginalURL
+}
+
+func toBreakdownItems(entries []domain.BreakdownEntry) []BreakdownItem {
+	items := make([]BreakdownItem, len(entries))
+	for i, e := range entries {
+		items[i] = BreakdownItem{Value: e.Value, Count: e.Count, Percent: e.Percent}
+	}
+	return items
+}
+
+// parseSeriesRange reads from/to (RFC3339) and tz (IANA name) for time-series stats; the range defaults to the last 30 days
+func parseSeriesRange(r *http.Request) (time.Time, time.Time, *time.Location, error) {
+	q := r.URL.Query()
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, time.Time{}, nil, &domain.ValidationError{Field: "tz", Message: "invalid tz (must be an IANA time zone name)"}
+		}
+		loc = l
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, nil, &domain.ValidationError{Field: "to", Message: "invalid to (must be RFC3339)"}
+		}
+		to = t
 	}
+	from := to.AddDate(0, 0, -30)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, nil, &domain.ValidationError{Field: "from", Message: "invalid from (must be RFC3339)"}
+		}
+		from = t
+	}
+	return from, to, loc, nil
 }
 
 // Add UserHandler for registration, login, and user URLs
@@ -183,6 +1027,7 @@ func NewUserHandler(service *service.UserService, urlService domain.URLService)
 // @Param        request  body   RegisterRequest  true  "Registration payload"
 // @Success      201      {object} SuccessResponse
 // @Failure      400      {object} ErrorResponse
+// @Failure      409      {object} ErrorResponse
 // @Router       /register [post]
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -190,16 +1035,23 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "", "Invalid request body")
+		return
+	}
+	if req.Username == "" {
+		badRequest(w, r, "username", "username is required")
+		return
+	}
+	if req.Password == "" {
+		badRequest(w, r, "password", "password is required")
 		return
 	}
 	_, err := h.service.Register(req.Username, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("Registration successful"))
+	writeJSON(w, http.StatusCreated, SuccessResponse{Message: "Registration successful"})
 }
 
 // Login godoc
@@ -219,26 +1071,20 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "", "Invalid request body")
 		return
 	}
 	token, err := h.service.Login(req.Username, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, r, err)
 		return
 	}
-	res := struct {
-		Token string `json:"token"`
-	}{Token: token}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
-	}
+	writeJSON(w, http.StatusOK, LoginResponse{Token: token})
 }
 
 // GetUserURLs godoc
 // @Summary      List user URLs
-// @Description  Returns all shortened URLs for the authenticated user
+// @Description  Returns all shortened URLs for the authenticated user, each with its state (scheduled, active, expired or exhausted)
 // @Tags         users
 // @Produce      json
 // @Security     ApiKeyAuth
@@ -248,16 +1094,67 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, domain.ErrUnauthorized)
 		return
 	}
 	urls, err := h.urlService.GetURLsByUser(userID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve URLs", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(urls); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+	writeJSON(w, http.StatusOK, urls)
+}
+
+// GetLinkDefaults godoc
+// @Summary      Get link defaults
+// @Description  Returns the fallback URL or expiry page used for the caller's expired or exhausted links that don't set their own
+// @Tags         users
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200      {object} LinkDefaultsRequest
+// @Failure      401      {object} ErrorResponse
+// @Router       /user/link-defaults [get]
+func (h *UserHandler) GetLinkDefaults(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, r, domain.ErrUnauthorized)
+		return
+	}
+	defaults, err := h.urlService.LinkDefaults(userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, LinkDefaultsRequest{FallbackURL: defaults.FallbackURL, ExpiredPage: defaults.ExpiredPage})
+}
+
+// SetLinkDefaults godoc
+// @Summary      Set link defaults
+// @Description  Replaces the fallback URL and expiry page used for the caller's expired or exhausted links that don't set their own; empty values remove them
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body   LinkDefaultsRequest  true  "Link defaults"
+// @Success      200      {object} LinkDefaultsRequest
+// @Failure      400      {object} ErrorResponse
+// @Failure      401      {object} ErrorResponse
+// @Router       /user/link-defaults [put]
+func (h *UserHandler) SetLinkDefaults(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, r, domain.ErrUnauthorized)
+		return
+	}
+	var req LinkDefaultsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "", "Invalid request body")
+		return
+	}
+	defaults, err := h.urlService.SetLinkDefaults(userID, domain.LinkDefaults{FallbackURL: req.FallbackURL, ExpiredPage: req.ExpiredPage})
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	writeJSON(w, http.StatusOK, LinkDefaultsRequest{FallbackURL: defaults.FallbackURL, ExpiredPage: defaults.ExpiredPage})
 }
@@ -0,0 +1,381 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// redirectStub answers Follow, Preview and Unlock and leaves the rest of domain.URLService unimplemented
+type redirectStub struct {
+	domain.URLService
+	follow  func(shortURL string, visit domain.Visit) (*domain.RedirectTarget, error)
+	preview func(shortURL string) (*model.URL, error)
+	unlock  func(shortURL, password string) (string, error)
+}
+
+func (s redirectStub) Follow(shortURL string, visit domain.Visit) (*domain.RedirectTarget, error) {
+	return s.follow(shortURL, visit)
+}
+
+func (s redirectStub) Preview(shortURL string, _ domain.Visit) (*model.URL, error) {
+	return s.preview(shortURL)
+}
+
+func (s redirectStub) Unlock(shortURL, password, _ string) (string, error) {
+	return s.unlock(shortURL, password)
+}
+
+func TestRedirectShowsInterstitialForQuarantinedLinks(t *testing.T) {
+	svc := redirectStub{follow: func(_ string, visit domain.Visit) (*domain.RedirectTarget, error) {
+		if visit.Proceed {
+			return &domain.RedirectTarget{URL: "https://evil.example/<x>", Type: domain.RedirectFound}, nil
+		}
+		return nil, &domain.QuarantineError{Destination: "https://evil.example/<x>", Reason: "domain evil.example is blocklisted"}
+	}}
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Body.String(), "https://evil.example/&lt;x&gt;")
+	assert.Contains(t, rec.Body.String(), `href="/abc123?proceed=1"`)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc123?proceed=1", nil))
+	assert.Equal(t, http.StatusFound, rec.Code)
+}
+
+func TestPreviewPage(t *testing.T) {
+	link := &model.URL{
+		ShortenedURL: "abc123",
+		OriginalURL:  "https://example.com/sale",
+		Title:        "Summer <sale>",
+		CreatedAt:    time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		ClickCount:   42,
+	}
+	svc := redirectStub{
+		follow: func(string, domain.Visit) (*domain.RedirectTarget, error) {
+			return nil, &domain.PreviewError{Link: link}
+		},
+		preview: func(shortURL string) (*model.URL, error) {
+			if shortURL != "abc123" {
+				return nil, domain.ErrNotFound
+			}
+			return link, nil
+		},
+	}
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+
+	// + suffix, preview=1 and a forced preview all render the page
+	for _, path := range []string{"/abc123+", "/abc123?preview=1", "/abc123"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		body := rec.Body.String()
+		assert.Contains(t, body, "Summer &lt;sale&gt;", path)
+		assert.Contains(t, body, "https://example.com/sale", path)
+		assert.Contains(t, body, "June 1, 2025", path)
+		assert.Contains(t, body, "<dd>42</dd>", path)
+		assert.Contains(t, body, `href="/abc123?proceed=1"`, path)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing+", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRedirectTypes(t *testing.T) {
+	tests := []struct {
+		target       domain.RedirectTarget
+		status       int
+		cacheControl string
+	}{
+		{domain.RedirectTarget{Type: domain.RedirectFound}, http.StatusFound, "private, no-store"},
+		{domain.RedirectTarget{Type: domain.RedirectTemporary}, http.StatusTemporaryRedirect, "private, no-store"},
+		{domain.RedirectTarget{Type: domain.RedirectMovedPermanently, MaxAge: time.Hour}, http.StatusMovedPermanently, "public, max-age=3600"},
+		{domain.RedirectTarget{Type: domain.RedirectPermanent, MaxAge: 24 * time.Hour}, http.StatusPermanentRedirect, "public, max-age=86400"},
+		// permanent links the service won't let clients cache, e.g. click-limited ones
+		{domain.RedirectTarget{Type: domain.RedirectPermanent}, http.StatusPermanentRedirect, "private, no-store"},
+	}
+	for _, tt := range tests {
+		target := tt.target
+		target.URL = "https://example.com/sale"
+		svc := redirectStub{follow: func(string, domain.Visit) (*domain.RedirectTarget, error) {
+			return &target, nil
+		}}
+		r := chi.NewRouter()
+		r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+		assert.Equal(t, tt.status, rec.Code, target.Type)
+		assert.Equal(t, "https://example.com/sale", rec.Header().Get("Location"), target.Type)
+		assert.Equal(t, tt.cacheControl, rec.Header().Get("Cache-Control"), target.Type)
+	}
+}
+
+func TestHTMLRedirect(t *testing.T) {
+	svc := redirectStub{follow: func(string, domain.Visit) (*domain.RedirectTarget, error) {
+		return &domain.RedirectTarget{URL: "https://example.com/a?b=1&c='x'", Type: domain.RedirectHTML}, nil
+	}}
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	body := rec.Body.String()
+	assert.Contains(t, body, `<meta http-equiv="refresh" content="0; url=https://example.com/a?b=1&amp;c=&#39;x&#39;">`)
+	assert.Contains(t, body, `window.location.replace("https://example.com/a?b=1\u0026c='x'")`)
+}
+
+func TestPasswordProtectedLinks(t *testing.T) {
+	link := &model.URL{ShortenedURL: "docs", Title: "Team docs", PasswordHash: "hash"}
+	svc := redirectStub{
+		follow: func(_ string, visit domain.Visit) (*domain.RedirectTarget, error) {
+			if visit.UnlockToken != "token" {
+				return nil, &domain.PasswordError{Link: link}
+			}
+			return &domain.RedirectTarget{URL: "https://intranet.example/docs", Type: domain.RedirectPermanent, MaxAge: time.Hour}, nil
+		},
+		unlock: func(_, password string) (string, error) {
+			switch password {
+			case "right":
+				return "token", nil
+			case "spam":
+				return "", domain.ErrTooManyAttempts
+			}
+			return "", domain.ErrInvalidCredentials
+		},
+	}
+	r := chi.NewRouter()
+	h := NewURLHandler(svc)
+	r.Get("/{shortURL}", h.RedirectURL)
+	r.Post("/{shortURL}", h.UnlockURL)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs?ref=mail", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Team docs")
+	assert.Contains(t, rec.Body.String(), `action="/docs?ref=mail"`)
+	assert.NotContains(t, rec.Body.String(), "intranet.example")
+
+	unlock := func(path, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = unlock("/docs?ref=mail", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Wrong password")
+	assert.Empty(t, rec.Result().Cookies())
+	assert.Equal(t, http.StatusTooManyRequests, unlock("/docs", "spam").Code)
+
+	rec = unlock("/docs?ref=mail", "right")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/docs?ref=mail", rec.Header().Get("Location"))
+	cookies := rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "/docs", cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/docs?ref=mail", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+	assert.Equal(t, "https://intranet.example/docs", rec.Header().Get("Location"))
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+
+	// Unlocking from /docs+ continues to the preview on a path the cookie is sent to
+	rec = unlock("/docs+", "right")
+	assert.Equal(t, "/docs?preview=1", rec.Header().Get("Location"))
+}
+
+func TestComingSoon(t *testing.T) {
+	launch := time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC)
+	teaser := ""
+	svc := redirectStub{follow: func(string, domain.Visit) (*domain.RedirectTarget, error) {
+		return nil, &domain.ScheduledError{ActivatesAt: launch, ComingSoonURL: teaser}
+	}}
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/launch", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "September 1, 2025")
+
+	teaser = "https://example.com/teaser"
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/launch", nil))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, teaser, rec.Header().Get("Location"))
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+}
+
+func TestEndedLinkFallbacks(t *testing.T) {
+	ended := &domain.EndedError{Err: domain.ErrExpired}
+	svc := redirectStub{follow: func(string, domain.Visit) (*domain.RedirectTarget, error) {
+		return nil, ended
+	}}
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/promo", nil))
+		return rec
+	}
+
+	rec := get()
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"link_expired"`)
+
+	ended.Page = "<h1>This offer has ended</h1><script>steal()</script>"
+	rec = get()
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, ended.Page, rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Security-Policy"), "sandbox")
+
+	ended.FallbackURL = "https://example.com/current-promo"
+	rec = get()
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, ended.FallbackURL, rec.Header().Get("Location"))
+}
+
+func TestVariantVisitorCookie(t *testing.T) {
+	var visitors []domain.Visit
+	svc := redirectStub{follow: func(shortURL string, visit domain.Visit) (*domain.RedirectTarget, error) {
+		visitors = append(visitors, visit)
+		if shortURL == "split" {
+			visitorID := visit.VisitorID
+			if visitorID == "" {
+				visitorID = "ip-" + visit.IP
+			}
+			return &domain.RedirectTarget{URL: "https://example.com/b", Type: domain.RedirectFound, VariantID: 2, VisitorID: visitorID}, nil
+		}
+		return &domain.RedirectTarget{URL: "https://example.com", Type: domain.RedirectFound}, nil
+	}}
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewURLHandler(svc).RedirectURL)
+	get := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "198.51.100.4:5000"
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Links without variants don't set cookies
+	assert.Empty(t, get("/plain", nil).Result().Cookies())
+
+	// Visitors without a cookie are picked for by their address, on every visit, and are given
+	// the ID their variant was picked for
+	for i := 0; i < 2; i++ {
+		cookies := get("/split", nil).Result().Cookies()
+		if assert.Len(t, cookies, 1) {
+			assert.Equal(t, "visitor_id", cookies[0].Name)
+			assert.Equal(t, "ip-198.51.100.4", cookies[0].Value)
+			assert.True(t, cookies[0].HttpOnly)
+		}
+	}
+	assert.Empty(t, visitors[1].VisitorID)
+	assert.Empty(t, visitors[2].VisitorID)
+	assert.Equal(t, visitors[1].IP, visitors[2].IP)
+
+	// Returning visitors are recognized and not given a new ID
+	rec := get("/split", &http.Cookie{Name: "visitor_id", Value: "returning"})
+	assert.Equal(t, "returning", visitors[3].VisitorID)
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestPassthroughRequest(t *testing.T) {
+	var got domain.Visit
+	svc := redirectStub{
+		follow: func(_ string, visit domain.Visit) (*domain.RedirectTarget, error) {
+			got = visit
+			return &domain.RedirectTarget{URL: "https://docs.example", Type: domain.RedirectFound}, nil
+		},
+		unlock: func(string, string) (string, error) { return "token", nil },
+	}
+	h := NewURLHandler(svc)
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", h.RedirectURL)
+	r.Get("/{shortURL}/*", h.RedirectURL)
+	r.Post("/{shortURL}/*", h.UnlockURL)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/guide/getting%20started?gclid=abc", nil))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "guide/getting started", got.ExtraPath)
+	assert.Equal(t, "gclid=abc", got.Query)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Empty(t, got.ExtraPath)
+
+	// Unlocking sends the visitor back to the path they asked for
+	req := httptest.NewRequest(http.MethodPost, "/docs/guide/getting%20started?gclid=abc", strings.NewReader("password=pw"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/docs/guide/getting%20started?gclid=abc", rec.Header().Get("Location"))
+	if cookies := rec.Result().Cookies(); assert.Len(t, cookies, 1) {
+		assert.Equal(t, "/docs", cookies[0].Path)
+	}
+}
+
+// shortenStub answers ShortenLink and leaves the rest of domain.URLService unimplemented
+type shortenStub struct {
+	domain.URLService
+	shorten func(opts domain.ShortenOptions) (string, error)
+}
+
+func (s shortenStub) ShortenLink(opts domain.ShortenOptions) (string, error) {
+	return s.shorten(opts)
+}
+
+func TestShortenLeavesAliasChecksToTheService(t *testing.T) {
+	svc := shortenStub{shorten: func(opts domain.ShortenOptions) (string, error) {
+		switch opts.CustomAlias {
+		case "taken":
+			return "", domain.ErrAliasTaken
+		case "bad alias":
+			return "", &domain.ValidationError{Field: "custom_alias", Message: "custom_alias must contain only letters, digits, dash or underscore"}
+		}
+		return opts.CustomAlias, nil
+	}}
+	h := NewURLHandler(svc)
+
+	for alias, want := range map[string]int{
+		"spring_sale": http.StatusOK,
+		"taken":       http.StatusConflict,
+		"bad alias":   http.StatusBadRequest,
+	} {
+		body := strings.NewReader(`{"url":"https://example.com","custom_alias":"` + alias + `"}`)
+		rec := httptest.NewRecorder()
+		h.ShortenURL(rec, httptest.NewRequest(http.MethodPost, "/shorten", body))
+		assert.Equal(t, want, rec.Code, alias)
+	}
+}
@@ -4,7 +4,7 @@ import "time"
 
 // ShortenRequest defines payload for shorten URL endpoint
 // swagger:model ShortenRequest
-// Example: {"url":"https://example.com","custom_alias":"my-sale","expiration":"2025-12-31T23:59:59Z","max_clicks":100,"utm_source":"newsletter","utm_medium":"email","utm_campaign":"summer_sale"}
+// Example: {"url":"https://example.com","custom_alias":"my-sale","expiration":"2025-12-31T23:59:59Z","max_clicks":100,"utm_source":"newsletter","utm_medium":"email","utm_campaign":"summer_sale","redirect_type":"302"}
 type ShortenRequest struct {
 	URL         string  `json:"url" example:"https://example.com" binding:"required"`
 	CustomAlias string  `json:"custom_alias,omitempty" example:"my-sale"`
@@ -13,6 +13,80 @@ type ShortenRequest struct {
 	UTMSource   string  `json:"utm_source,omitempty" example:"newsletter"`
 	UTMMedium   string  `json:"utm_medium,omitempty" example:"email"`
 	UTMCampaign string  `json:"utm_campaign,omitempty" example:"summer_sale"`
+	// RedirectType is 301, 302, 307, 308 or html for a page that redirects from the browser; 302 by default
+	RedirectType string `json:"redirect_type,omitempty" example:"302" enums:"301,302,307,308,html"`
+	// Password, if set, must be entered before visitors are redirected
+	Password string `json:"password,omitempty" example:"s3cret"`
+	// ActivatesAt schedules the link; until then visitors get a coming soon page or ComingSoonURL
+	ActivatesAt   string `json:"activates_at,omitempty" example:"2025-09-01T09:00:00Z"`
+	ComingSoonURL string `json:"coming_soon_url,omitempty" example:"https://example.com/teaser"`
+	// FallbackURL, or else ExpiredPage (HTML), is served instead of 410 once the link expired or ran out of clicks.
+	// ExpiredPage needs a signed-in caller.
+	FallbackURL string `json:"fallback_url,omitempty" example:"https://example.com/current-promo"`
+	ExpiredPage string `json:"expired_page,omitempty" example:"<h1>This offer has ended</h1>"`
+	// QueryPassthrough merges the query string visitors arrive with into the destination; on
+	// conflicts keep leaves the destination's value, override replaces it and append sends both
+	QueryPassthrough string `json:"query_passthrough,omitempty" example:"keep" enums:"keep,override,append"`
+	// PathPassthrough appends path segments after the code to the destination (/abc123/docs/intro)
+	PathPassthrough bool `json:"path_passthrough,omitempty" example:"true"`
+}
+
+// UpdateLinkRequest defines payload for the link update endpoint; every field is optional
+// swagger:model UpdateLinkRequest
+// Example: {"url":"https://example.com/fixed","expiration":null,"max_clicks":500,"title":"Summer sale","force_preview":true}
+type UpdateLinkRequest struct {
+	URL              *string `json:"url,omitempty" example:"https://example.com/fixed"`
+	CustomAlias      *string `json:"custom_alias,omitempty" example:"summer-sale"`
+	Expiration       *string `json:"expiration,omitempty" example:"2025-12-31T23:59:59Z"`
+	MaxClicks        *uint64 `json:"max_clicks,omitempty" example:"500"`
+	UTMSource        *string `json:"utm_source,omitempty" example:"newsletter"`
+	UTMMedium        *string `json:"utm_medium,omitempty" example:"email"`
+	UTMCampaign      *string `json:"utm_campaign,omitempty" example:"summer_sale"`
+	Title            *string `json:"title,omitempty" example:"Summer sale"`
+	ForcePreview     *bool   `json:"force_preview,omitempty" example:"true"`
+	RedirectType     *string `json:"redirect_type,omitempty" example:"308" enums:"301,302,307,308,html"`
+	Password         *string `json:"password,omitempty" example:"s3cret"`
+	ActivatesAt      *string `json:"activates_at,omitempty" example:"2025-09-01T09:00:00Z"`
+	ComingSoonURL    *string `json:"coming_soon_url,omitempty" example:"https://example.com/teaser"`
+	FallbackURL      *string `json:"fallback_url,omitempty" example:"https://example.com/current-promo"`
+	ExpiredPage      *string `json:"expired_page,omitempty" example:"<h1>This offer has ended</h1>"`
+	QueryPassthrough *string `json:"query_passthrough,omitempty" example:"override" enums:"keep,override,append"`
+	PathPassthrough  *bool   `json:"path_passthrough,omitempty" example:"true"`
+}
+
+// RedirectRuleRequest defines a routing rule of a link. Every condition that is set must match and
+// list conditions match any of their values; at least one condition is required.
+// swagger:model RedirectRuleRequest
+// Example: {"destination":"https://apps.apple.com/app/id123","os":["iOS"]}
+type RedirectRuleRequest struct {
+	Destination string     `json:"destination" example:"https://apps.apple.com/app/id123"`
+	Position    int        `json:"position,omitempty" example:"1"` // 1-based; omitted adds the rule last
+	Devices     []string   `json:"devices,omitempty" example:"mobile"`
+	OS          []string   `json:"os,omitempty" example:"iOS"`
+	Languages   []string   `json:"languages,omitempty" example:"de"`
+	Countries   []string   `json:"countries,omitempty" example:"MD"`
+	TimeFrom    string     `json:"time_from,omitempty" example:"09:00"`
+	TimeTo      string     `json:"time_to,omitempty" example:"17:30"`
+	TimeZone    string     `json:"time_zone,omitempty" example:"Europe/Chisinau"`
+	StartsAt    *time.Time `json:"starts_at,omitempty" example:"2025-11-28T00:00:00Z"`
+	EndsAt      *time.Time `json:"ends_at,omitempty" example:"2025-12-01T00:00:00Z"`
+}
+
+// LinkVariantRequest defines one weighted destination of an A/B split
+// swagger:model LinkVariantRequest
+// Example: {"label":"B","destination":"https://example.com/landing-b","weight":30}
+type LinkVariantRequest struct {
+	Label       string `json:"label,omitempty" example:"B"`
+	Destination string `json:"destination" example:"https://example.com/landing-b"`
+	Weight      int    `json:"weight" example:"30"` // Relative share of visitors, 1-1000
+}
+
+// LinkDefaultsRequest holds a user's fallback for expired or exhausted links without their own
+// swagger:model LinkDefaultsRequest
+// Example: {"fallback_url":"https://example.com/current-promo"}
+type LinkDefaultsRequest struct {
+	FallbackURL string `json:"fallback_url" example:"https://example.com/current-promo"`
+	ExpiredPage string `json:"expired_page" example:"<h1>This offer has ended</h1>"`
 }
 
 // ShortenResponse defines response for shorten URL endpoint
@@ -24,12 +98,61 @@ type ShortenResponse struct {
 
 // StatsResponse defines response for stats endpoint
 // swagger:model StatsResponse
-// Example: {"short_url":"qIhf8TFq","original_url":"https://example.com","click_count":10,"last_clicked_at":"2025-07-11T22:00:00Z"}
+// Example: {"short_url":"qIhf8TFq","original_url":"https://example.com","click_count":10,"last_clicked_at":"2025-07-11T22:00:00Z","state":"active"}
 type StatsResponse struct {
-	ShortURL      string     `json:"short_url" example:"qIhf8TFq"`
-	OriginalURL   string     `json:"original_url" example:"https://example.com"`
-	ClickCount    uint64     `json:"click_count" example:"10"`
-	LastClickedAt *time.Time `json:"last_clicked_at" example:"2025-07-11T22:00:00Z"`
+	ShortURL      string           `json:"short_url" example:"qIhf8TFq"`
+	OriginalURL   string           `json:"original_url" example:"https://example.com"`
+	ClickCount    uint64           `json:"click_count" example:"10"`
+	LastClickedAt *time.Time       `json:"last_clicked_at" example:"2025-07-11T22:00:00Z"`
+	State         string           `json:"state" example:"active" enums:"scheduled,active,expired,exhausted,deleted"`
+	ActivatesAt   *time.Time       `json:"activates_at,omitempty" example:"2025-07-01T09:00:00Z"`
+	Expiration    *time.Time       `json:"expiration,omitempty" example:"2025-12-31T23:59:59Z"`
+	Interval      string           `json:"interval,omitempty" example:"day"`
+	TimeZone      string           `json:"tz,omitempty" example:"Europe/Chisinau"`
+	Series        []StatsBucket    `json:"series,omitempty"`
+	Breakdowns    *StatsBreakdowns `json:"breakdowns,omitempty"`
+	Variants      []StatsVariant   `json:"variants,omitempty"`
+}
+
+// StatsVariant is one A/B variant with its configured share of visitors and the clicks it got
+// swagger:model StatsVariant
+// Example: {"id":2,"label":"B","destination":"https://example.com/landing-b","weight":30,"weight_percent":30.0,"clicks":28,"click_percent":28.9}
+type StatsVariant struct {
+	ID            uint    `json:"id" example:"2"`
+	Label         string  `json:"label,omitempty" example:"B"`
+	Destination   string  `json:"destination,omitempty" example:"https://example.com/landing-b"`
+	Weight        int     `json:"weight" example:"30"`
+	WeightPercent float64 `json:"weight_percent" example:"30.0"`
+	Clicks        uint64  `json:"clicks" example:"28"`
+	ClickPercent  float64 `json:"click_percent" example:"28.9"`
+}
+
+// StatsBreakdowns groups recorded clicks by source and client
+// swagger:model StatsBreakdowns
+type StatsBreakdowns struct {
+	Referrers []BreakdownItem `json:"referrers"`
+	Devices   []BreakdownItem `json:"devices"`
+	Browsers  []BreakdownItem `json:"browsers"`
+	OS        []BreakdownItem `json:"os"`
+	Countries []BreakdownItem `json:"countries"`
+	Cities    []BreakdownItem `json:"cities"`
+}
+
+// BreakdownItem is one value of a breakdown with its click count and share
+// swagger:model BreakdownItem
+// Example: {"value":"news.ycombinator.com","count":42,"percent":35.0}
+type BreakdownItem struct {
+	Value   string  `json:"value" example:"news.ycombinator.com"`
+	Count   uint64  `json:"count" example:"42"`
+	Percent float64 `json:"percent" example:"35.0"`
+}
+
+// StatsBucket is one point of the click time-series
+// swagger:model StatsBucket
+// Example: {"start":"2025-07-11T00:00:00+03:00","count":4}
+type StatsBucket struct {
+	Start time.Time `json:"start" example:"2025-07-11T00:00:00+03:00"`
+	Count uint64    `json:"count" example:"4"`
 }
 
 // RegisterRequest defines payload for user registration
@@ -55,11 +178,15 @@ type LoginResponse struct {
 	Token string `json:"token" example:"<jwt-token>"`
 }
 
-// ErrorResponse defines error response
+// ErrorResponse is the envelope every endpoint uses for errors. Details carries extra context,
+// such as the offending field, and RequestID matches the X-Request-ID response header.
 // swagger:model ErrorResponse
-// Example: {"message":"error description"}
+// Example: {"code":"invalid_input","message":"max_clicks must be > 0","details":{"field":"max_clicks"},"request_id":"9f86d081884c7d65"}
 type ErrorResponse struct {
-	Message string `json:"message" example:"error description"`
+	Code      string            `json:"code" example:"invalid_input"`
+	Message   string            `json:"message" example:"max_clicks must be > 0"`
+	Details   map[string]string `json:"details,omitempty"`
+	RequestID string            `json:"request_id,omitempty" example:"9f86d081884c7d65"`
 }
 
 // SuccessResponse defines a simple success message
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// interstitialPage warns visitors before sending them to a quarantined destination
+var interstitialPage = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Warning: this link may be unsafe</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:4rem auto;padding:0 1rem;color:#222}
+h1{color:#b00020}
+code{word-break:break-all;background:#f4f4f4;padding:.1rem .3rem}
+a.proceed{color:#666;font-size:.9rem}
+</style>
+</head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The link you followed leads to <code>{{.Destination}}</code>, which was flagged: {{.Reason}}.</p>
+<p>It may try to steal your passwords or install malware. We recommend you don't continue.</p>
+<p><a href="javascript:history.back()">Go back</a></p>
+<p><a class="proceed" href="{{.ProceedURL}}" rel="nofollow noreferrer">I understand the risk, continue anyway</a></p>
+</body>
+</html>
+`))
+
+// previewPage shows where a short link leads before following it
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:4rem auto;padding:0 1rem;color:#222}
+code{word-break:break-all;background:#f4f4f4;padding:.1rem .3rem}
+dt{color:#666;font-size:.9rem;margin-top:.8rem}
+dd{margin:0}
+.warning{color:#b00020}
+a.continue{display:inline-block;margin-top:1.5rem;padding:.5rem 1rem;background:#1a73e8;color:#fff;text-decoration:none;border-radius:4px}
+</style>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</h1>
+<dl>
+<dt>This link leads to</dt>
+<dd><code>{{.Destination}}</code></dd>
+<dt>Created</dt>
+<dd>{{.CreatedAt.Format "January 2, 2006"}}</dd>
+<dt>Clicks</dt>
+<dd>{{.ClickCount}}</dd>
+</dl>
+{{if .Warning}}<p class="warning">Warning: this link was flagged: {{.Warning}}.</p>{{end}}
+<a class="continue" href="{{.ProceedURL}}" rel="nofollow">Continue to destination</a>
+</body>
+</html>
+`))
+
+// redirectPage forwards visitors from the browser, for links whose redirect type is html
+var redirectPage = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url={{.Destination}}">
+<title>Redirecting…</title>
+<script>window.location.replace({{.Destination}});</script>
+</head>
+<body>
+<p>Redirecting to <a href="{{.Destination}}">{{.Destination}}</a>…</p>
+</body>
+</html>
+`))
+
+// unlockPage asks for the password of a protected link
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Password required{{end}}</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:4rem auto;padding:0 1rem;color:#222}
+.error{color:#b00020}
+input{font-size:1rem;padding:.4rem;margin-right:.5rem}
+button{font-size:1rem;padding:.4rem 1rem}
+</style>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Password required{{end}}</h1>
+<p>This link is password protected.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="password" name="password" aria-label="Password" placeholder="Password" autocomplete="current-password" required autofocus>
+<button type="submit">Unlock</button>
+</form>
+</body>
+</html>
+`))
+
+// comingSoonPage stands in for a scheduled link until it activates
+var comingSoonPage = template.Must(template.New("coming-soon").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Coming soon</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:4rem auto;padding:0 1rem;color:#222}
+</style>
+</head>
+<body>
+<h1>Coming soon</h1>
+<p>This link goes live on <time datetime="{{.ActivatesAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.ActivatesAt.Format "January 2, 2006 at 15:04 MST"}}</time>. Check back then!</p>
+</body>
+</html>
+`))
+
+type comingSoonData struct {
+	ActivatesAt time.Time
+}
+
+type unlockData struct {
+	Title  string
+	Action string
+	Error  string
+}
+
+type redirectData struct {
+	Destination string
+}
+
+type previewData struct {
+	Title       string
+	Destination string
+	CreatedAt   time.Time
+	ClickCount  uint64
+	Warning     string
+	ProceedURL  string
+}
+
+type interstitialData struct {
+	Destination string
+	Reason      string
+	ProceedURL  string
+}
+
+// renderPage writes an HTML page; pages are never cached since the link behind them can change
+func renderPage(w http.ResponseWriter, status int, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := page.Execute(w, data); err != nil {
+		log.Printf("failed to render %s page: %v", page.Name(), err)
+	}
+}
+
+// customPagePolicy sandboxes pages written by link owners: no scripts, forms or requests back to us
+const customPagePolicy = "sandbox; default-src 'none'; img-src https: data:; style-src 'unsafe-inline' https:; font-src https:"
+
+// renderCustomPage serves HTML written by a link owner, such as an expiry page
+func renderCustomPage(w http.ResponseWriter, status int, page string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", customPagePolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if _, err := io.WriteString(w, page); err != nil {
+		log.Printf("failed to write custom page: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+// Package cache defines the shared cache used to resolve short codes across replicas.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache is a key/value store shared by every instance of the service
+type Cache interface {
+	// Get returns the value for key; ok is false when the key is missing or expired
+	Get(key string) (value []byte, ok bool, err error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+// PubSub broadcasts messages, such as cache invalidations, to every instance
+type PubSub interface {
+	Publish(channel, message string) error
+	// Subscribe calls handle for each message on channel until ctx is cancelled
+	Subscribe(ctx context.Context, channel string, handle func(message string)) error
+}
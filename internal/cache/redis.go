@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisCache talks to Redis, or anything speaking the RESP protocol, over plain TCP
+type RedisCache struct {
+	addr     string
+	password string
+	timeout  time.Duration
+	pool     chan *respConn
+}
+
+const (
+	redisPoolSize      = 16
+	redisTimeout       = 2 * time.Second
+	redisResubscribeIn = time.Second
+)
+
+// errNil is returned for RESP null replies
+var errNil = errors.New("redis: nil")
+
+// RedisError is an error reply sent by the server
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+func NewRedisCache(addr, password string) *RedisCache {
+	return &RedisCache{
+		addr:     addr,
+		password: password,
+		timeout:  redisTimeout,
+		pool:     make(chan *respConn, redisPoolSize),
+	}
+}
+
+func (c *RedisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", key)
+	if errors.Is(err, errNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	b, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return b, true, nil
+}
+
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(args...)
+	return err
+}
+
+func (c *RedisCache) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.do(append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+func (c *RedisCache) Publish(channel, message string) error {
+	_, err := c.do("PUBLISH", channel, message)
+	return err
+}
+
+// Subscribe keeps a dedicated connection subscribed to channel, reconnecting after failures
+func (c *RedisCache) Subscribe(ctx context.Context, channel string, handle func(message string)) error {
+	for {
+		err := c.subscribeOnce(ctx, channel, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("redis subscription to %s lost: %v", channel, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(redisResubscribeIn):
+		}
+	}
+}
+
+func (c *RedisCache) subscribeOnce(ctx context.Context, channel string, handle func(message string)) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.write("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		// Pushed messages look like ["message", channel, payload]
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		kind, _ := parts[0].([]byte)
+		payload, _ := parts[2].([]byte)
+		if string(kind) == "message" {
+			handle(string(payload))
+		}
+	}
+}
+
+// do runs one command on a pooled connection
+func (c *RedisCache) do(args ...string) (any, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := conn.write(args...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := conn.read()
+	var redisErr RedisError
+	if err != nil && !errors.Is(err, errNil) && !errors.As(err, &redisErr) {
+		// the connection state is unknown after an I/O error
+		conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+func (c *RedisCache) get() (*respConn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+		return c.dial()
+	}
+}
+
+func (c *RedisCache) put(conn *respConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (c *RedisCache) dial() (*respConn, error) {
+	nc, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &respConn{Conn: nc, r: bufio.NewReader(nc)}
+	if c.password != "" {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+		if err := conn.write("AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if _, err := conn.read(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+type respConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// write sends a command as a RESP array of bulk strings
+func (c *respConn) write(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, a := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(a)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, a...)
+		buf = append(buf, '\r', '\n')
+	}
+	_, err := c.Write(buf)
+	return err
+}
+
+// read parses one reply: strings and bulk strings become []byte, integers int64, arrays []any
+func (c *respConn) read() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+	body := string(line[1:])
+	switch line[0] {
+	case '+':
+		return []byte(body), nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := c.read()
+			if err != nil && !errors.Is(err, errNil) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+}
+
+func (c *respConn) readLine() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply line")
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,193 @@
+package cache_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is an in-process server implementing the RESP commands RedisCache uses
+type fakeRedis struct {
+	ln          net.Listener
+	mu          sync.Mutex
+	data        map[string]string
+	expires     map[string]time.Time
+	subscribers map[string][]net.Conn
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeRedis{
+		ln:          ln,
+		data:        make(map[string]string),
+		expires:     make(map[string]time.Time),
+		subscribers: make(map[string][]net.Conn),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		reply := s.exec(conn, args)
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) exec(conn net.Conn, args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING", "AUTH":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := s.data[args[1]]
+		if exp, has := s.expires[args[1]]; ok && has && time.Now().After(exp) {
+			delete(s.data, args[1])
+			ok = false
+		}
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "SET":
+		s.data[args[1]] = args[2]
+		delete(s.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := s.data[k]; ok {
+				n++
+			}
+			delete(s.data, k)
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "PUBLISH":
+		subs := s.subscribers[args[1]]
+		for _, c := range subs {
+			io.WriteString(c, "*3\r\n"+bulk("message")+bulk(args[1])+bulk(args[2]))
+		}
+		return fmt.Sprintf(":%d\r\n", len(subs))
+	case "SUBSCRIBE":
+		s.subscribers[args[1]] = append(s.subscribers[args[1]], conn)
+		return "*3\r\n" + bulk("subscribe") + bulk(args[1]) + ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (s *fakeRedis) subscriberCount(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers[channel])
+}
+
+func bulk(v string) string { return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n" }
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisCacheCommands(t *testing.T) {
+	srv := startFakeRedis(t)
+	c := cache.NewRedisCache(srv.addr(), "secret")
+
+	_, ok, err := c.Get("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Set("k", []byte("value\r\nwith crlf"), time.Minute))
+	v, ok, err := c.Get("k")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value\r\nwith crlf", string(v))
+
+	require.NoError(t, c.Set("short", []byte("x"), 20*time.Millisecond))
+	time.Sleep(40 * time.Millisecond)
+	_, ok, err = c.Get("short")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Delete("k"))
+	_, ok, err = c.Get("k")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRedisCachePubSub(t *testing.T) {
+	srv := startFakeRedis(t)
+	c := cache.NewRedisCache(srv.addr(), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := make(chan string, 1)
+	go c.Subscribe(ctx, "events", func(msg string) { got <- msg })
+	require.Eventually(t, func() bool { return srv.subscriberCount("events") == 1 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, c.Publish("events", "42"))
+	select {
+	case msg := <-got:
+		assert.Equal(t, "42", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+}
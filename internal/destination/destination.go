@@ -0,0 +1,173 @@
+// Package destination validates and normalizes the URLs short links point to.
+package destination
+
+import (
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"url-shortener/internal/domain"
+)
+
+// Reasons reported in ValidationError.Reason
+const (
+	ReasonRequired      = "required"
+	ReasonTooLong       = "too_long"
+	ReasonMalformed     = "malformed"
+	ReasonScheme        = "scheme_not_allowed"
+	ReasonHost          = "host_required"
+	ReasonInvalidHost   = "invalid_host"
+	ReasonCredentials   = "credentials_not_allowed"
+	ReasonSelfReference = "self_reference"
+)
+
+// DefaultMaxLength matches the longest destination browsers reliably follow
+const DefaultMaxLength = 2048
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Config tunes the Validator; zero values use the defaults
+type Config struct {
+	// AllowedSchemes defaults to http and https
+	AllowedSchemes []string
+	// MaxLength applies to the normalized URL and defaults to DefaultMaxLength
+	MaxLength int
+	// SelfHosts are the hosts serving short links; a destination on one of them would redirect to
+	// itself. Entries may carry a port.
+	SelfHosts []string
+}
+
+// Validator runs a destination through each check in order and returns its normalized form
+type Validator struct {
+	schemes   map[string]bool
+	maxLength int
+	selfHosts map[string]bool
+}
+
+func New(cfg Config) *Validator {
+	v := &Validator{
+		schemes:   make(map[string]bool),
+		maxLength: cfg.MaxLength,
+		selfHosts: make(map[string]bool),
+	}
+	if len(cfg.AllowedSchemes) == 0 {
+		cfg.AllowedSchemes = []string{"http", "https"}
+	}
+	for _, s := range cfg.AllowedSchemes {
+		v.schemes[strings.ToLower(s)] = true
+	}
+	if v.maxLength <= 0 {
+		v.maxLength = DefaultMaxLength
+	}
+	for _, h := range cfg.SelfHosts {
+		h = strings.TrimSpace(h)
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			host, port = h, ""
+		}
+		if host, err = normalizeHost(host); err != nil || host == "" {
+			continue
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		v.selfHosts[host] = true
+	}
+	return v
+}
+
+// Normalize checks raw and returns it with a lower-case scheme, an ASCII (punycode) host and no
+// default port. Failures are *domain.ValidationError for the "url" field.
+func (v *Validator) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", invalid(ReasonRequired, "url is required")
+	}
+	// Checked up front as well, so oversized input isn't parsed at all
+	if len(raw) > v.maxLength*4 {
+		return "", invalid(ReasonTooLong, "url is too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", invalid(ReasonMalformed, "url is malformed")
+	}
+	steps := []func(*url.URL) error{
+		v.checkScheme,
+		checkHost,
+		checkCredentials,
+		v.checkSelfReference,
+	}
+	for _, step := range steps {
+		if err := step(u); err != nil {
+			return "", err
+		}
+	}
+	normalized := u.String()
+	if len(normalized) > v.maxLength {
+		return "", invalid(ReasonTooLong, "url must be at most "+strconv.Itoa(v.maxLength)+" characters")
+	}
+	return normalized, nil
+}
+
+func (v *Validator) checkScheme(u *url.URL) error {
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		return invalid(ReasonScheme, "url must be absolute, e.g. https://example.com")
+	}
+	if !v.schemes[u.Scheme] {
+		return invalid(ReasonScheme, "url scheme "+u.Scheme+" is not allowed")
+	}
+	return nil
+}
+
+// checkHost requires a host, converts it to punycode and drops the scheme's default port
+func checkHost(u *url.URL) error {
+	if u.Opaque != "" || u.Host == "" {
+		return invalid(ReasonHost, "url must include a host")
+	}
+	hostname, port := u.Hostname(), u.Port()
+	host, err := normalizeHost(hostname)
+	if err != nil {
+		return invalid(ReasonInvalidHost, "url host is invalid")
+	}
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6 literal
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	return nil
+}
+
+// checkCredentials rejects user info, which is mostly used to disguise the real host
+func checkCredentials(u *url.URL) error {
+	if u.User != nil {
+		return invalid(ReasonCredentials, "url must not contain credentials")
+	}
+	return nil
+}
+
+func (v *Validator) checkSelfReference(u *url.URL) error {
+	if v.selfHosts[u.Hostname()] || v.selfHosts[u.Host] {
+		return invalid(ReasonSelfReference, "url points to this link shortener")
+	}
+	return nil
+}
+
+// normalizeHost lower-cases a host name without port, drops a trailing dot and converts it to ASCII
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+func invalid(reason, message string) error {
+	return &domain.ValidationError{Field: "url", Reason: reason, Message: message}
+}
@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"errors"
+	"time"
+	"url-shortener/internal/model"
+)
+
+// Sentinel errors returned by repositories and services; handlers map them to HTTP responses
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrExpired            = errors.New("link expired")
+	ErrClickLimit         = errors.New("click limit reached")
+	ErrDeleted            = errors.New("link deleted")
+	ErrNotActive          = errors.New("link not active yet")
+	ErrAliasTaken         = errors.New("custom alias already in use")
+	ErrAliasReserved      = errors.New("custom alias is reserved")
+	ErrUsernameTaken      = errors.New("username already exists")
+	ErrConflict           = errors.New("already exists")
+	ErrInvalidURL         = errors.New("invalid url")
+	ErrUnsafeURL          = errors.New("destination flagged as unsafe")
+	ErrQuarantined        = errors.New("link quarantined")
+	ErrPreviewRequired    = errors.New("link requires preview")
+	ErrPasswordRequired   = errors.New("link is password protected")
+	ErrTooManyAttempts    = errors.New("too many attempts, try again later")
+	ErrInvalidInput       = errors.New("invalid input")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrForbidden          = errors.New("forbidden")
+	ErrUnavailable        = errors.New("service unavailable")
+)
+
+// ValidationError reports an invalid request field; it matches ErrInvalidInput with errors.Is.
+// Reason is an optional machine-readable cause, such as "scheme_not_allowed".
+type ValidationError struct {
+	Field   string
+	Reason  string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// StorageError wraps a failure of the underlying store; it matches ErrUnavailable with errors.Is
+type StorageError struct {
+	Err error
+}
+
+func (e *StorageError) Error() string {
+	return "storage error: " + e.Err.Error()
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StorageError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// QuarantineError is returned when a flagged link is followed; it matches ErrQuarantined with
+// errors.Is and carries what the interstitial warning page shows
+type QuarantineError struct {
+	Destination string
+	Reason      string
+}
+
+func (e *QuarantineError) Error() string {
+	return "link quarantined: " + e.Reason
+}
+
+func (e *QuarantineError) Is(target error) bool {
+	return target == ErrQuarantined
+}
+
+// PreviewError is returned when a link set to always show its preview page is followed; it
+// matches ErrPreviewRequired with errors.Is
+type PreviewError struct {
+	Link *model.URL
+}
+
+func (e *PreviewError) Error() string {
+	return "link requires preview"
+}
+
+func (e *PreviewError) Is(target error) bool {
+	return target == ErrPreviewRequired
+}
+
+// PasswordError is returned when a password-protected link is followed without being unlocked; it
+// matches ErrPasswordRequired with errors.Is. Link must not be shown beyond its title.
+type PasswordError struct {
+	Link *model.URL
+}
+
+func (e *PasswordError) Error() string {
+	return "link is password protected"
+}
+
+func (e *PasswordError) Is(target error) bool {
+	return target == ErrPasswordRequired
+}
+
+// ScheduledError is returned when a link is followed before it activates; it matches ErrNotActive
+// with errors.Is. ComingSoonURL is where visitors go meanwhile, if anywhere.
+type ScheduledError struct {
+	ActivatesAt   time.Time
+	ComingSoonURL string
+}
+
+func (e *ScheduledError) Error() string {
+	return "link not active until " + e.ActivatesAt.Format(time.RFC3339)
+}
+
+func (e *ScheduledError) Is(target error) bool {
+	return target == ErrNotActive
+}
+
+// EndedError is returned when an expired or exhausted link is followed. Err is ErrExpired or
+// ErrClickLimit, which it matches with errors.Is; FallbackURL or else Page, both optional, is
+// what visitors get instead of an error.
+type EndedError struct {
+	Err         error
+	FallbackURL string
+	Page        string
+}
+
+func (e *EndedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EndedError) Unwrap() error {
+	return e.Err
+}
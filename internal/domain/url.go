@@ -7,18 +7,304 @@ import (
 
 type URLRepository interface {
 	Save(url *model.URL) error
+	FindByID(id uint) (*model.URL, error)
+	// FindByShortURL and FindByCustomAlias also load the link's rules and variants, so caches of
+	// redirect lookups hold everything a redirect needs
 	FindByShortURL(shortURL string) (*model.URL, error)
 	FindByCustomAlias(alias string) (*model.URL, error)
 	GetURLsByUser(userID uint) ([]model.URL, error)
+	// Update writes the settings an owner can edit. Counters, HasRules, HasVariants and the
+	// quarantine are kept by their own methods, so an edit never overwrites them with stale values.
 	Update(url *model.URL) error
+	IncrementClicks(deltas map[uint]ClickDelta) error
+	// ConsumeClick atomically counts one click unless the link's click limit is reached; it reports whether the click was counted
+	ConsumeClick(id uint, at time.Time) (bool, error)
+	SoftDelete(id uint) error
+	Restore(id uint) error
+	// Quarantine flags a link without touching its other columns
+	Quarantine(id uint, reason string) error
+	// ClearQuarantine lifts the flag, e.g. once the link points somewhere safe
+	ClearQuarantine(id uint) error
+	// SetHasRules records whether a link has redirect rules, without touching its other columns.
+	// It is called whenever the rules change, so cached copies of the link are dropped.
+	SetHasRules(id uint, hasRules bool) error
+	// SetHasVariants records whether a link has A/B variants, like SetHasRules
+	SetHasVariants(id uint, hasVariants bool) error
+	// PurgeDeleted permanently removes links soft-deleted before cutoff and returns their IDs
+	PurgeDeleted(cutoff time.Time) ([]uint, error)
+}
+
+// ClickDelta is the number of clicks to add to one link and the latest of their timestamps
+type ClickDelta struct {
+	Count         uint64
+	LastClickedAt time.Time
+}
+
+type ClickRepository interface {
+	Save(click *model.Click) error
+	SaveBatch(clicks []model.Click) error
+	FindByURLID(urlID uint) ([]model.Click, error)
+	// CountBetween counts a link's clicks in [from, to) per slot, a span of time counted from the Unix
+	// epoch; buckets start at their slot's start in UTC, and slots without clicks are left out
+	CountBetween(urlID uint, from, to time.Time, slot time.Duration) ([]ClickBucket, error)
+	CountBy(urlID uint, field string, limit int) ([]ValueCount, error)
+}
+
+// Click fields that can be grouped by ClickRepository.CountBy
+const (
+	ClickFieldReferrerDomain = "referrer_domain"
+	ClickFieldDevice         = "device"
+	ClickFieldBrowser        = "browser"
+	ClickFieldOS             = "os"
+	ClickFieldCountry        = "country"
+	ClickFieldCity           = "city"
+	ClickFieldVariant        = "variant_id"
+)
+
+// ValueCount is the number of clicks sharing one value of a click field
+type ValueCount struct {
+	Value string
+	Count uint64
+}
+
+// BreakdownEntry is a ValueCount with its share of all recorded clicks
+type BreakdownEntry struct {
+	Value   string
+	Count   uint64
+	Percent float64
+}
+
+// Breakdowns groups recorded clicks by where they came from
+type Breakdowns struct {
+	Referrers []BreakdownEntry
+	Devices   []BreakdownEntry
+	Browsers  []BreakdownEntry
+	OS        []BreakdownEntry
+	Countries []BreakdownEntry
+	Cities    []BreakdownEntry
+}
+
+// GeoLocator resolves a client IP to an ISO country code and city name
+type GeoLocator interface {
+	Locate(ip string) (country, city string, ok bool)
+}
+
+// Visit carries the request details recorded for each click
+type Visit struct {
+	Referrer       string
+	UserAgent      string
+	IP             string
+	AcceptLanguage string
+	// Proceed is set once the visitor has seen the interstitial warning and chose to continue
+	Proceed bool
+	// UnlockToken is the token URLService.Unlock issued for a password-protected link, if any
+	UnlockToken string
+	// VisitorID identifies a returning visitor, so A/B splits keep sending them to the same variant;
+	// without it one is derived from the IP address
+	VisitorID string
+	// Query is the raw query string of the short link request and ExtraPath the unescaped path
+	// after the code, which links with passthrough hand on to their destination
+	Query     string
+	ExtraPath string
+}
+
+// Bucket sizes supported by click time-series
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// ClickBucket is the number of clicks starting at Start for one interval
+type ClickBucket struct {
+	Start time.Time
+	Count uint64
+}
+
+// LinkUpdate is a partial update of a link; nil fields are left unchanged
+type LinkUpdate struct {
+	OriginalURL      *string
+	CustomAlias      *string // empty string removes the alias
+	ActivatesAt      *time.Time
+	ClearActivatesAt bool
+	ComingSoonURL    *string // empty string removes it
+	Expiration       *time.Time
+	ClearExpiration  bool
+	MaxClicks        *uint64
+	ClearMaxClicks   bool
+	FallbackURL      *string // empty string removes it
+	ExpiredPage      *string // empty string removes it
+	UTMSource        *string
+	UTMMedium        *string
+	UTMCampaign      *string
+	Title            *string // shown on the preview page; empty string removes it
+	ForcePreview     *bool   // always show the preview page before redirecting
+	RedirectType     *string // one of the Redirect* types; empty string restores the default
+	Password         *string // empty string removes the password
+	QueryPassthrough *string // one of the QueryPassthrough* policies; empty string stops passing the query on
+	PathPassthrough  *bool
+}
+
+// ShortenOptions describes a new link; only OriginalURL is required
+type ShortenOptions struct {
+	OriginalURL string
+	UserID      uint
+	CustomAlias string
+	ActivatesAt *time.Time // before it visitors see a "coming soon" response
+	// ComingSoonURL is where visitors go before ActivatesAt, instead of the coming soon page
+	ComingSoonURL string
+	Expiration    *time.Time
+	MaxClicks     *uint64
+	// FallbackURL, or else ExpiredPage, replaces the error once the link expired or ran out of clicks
+	FallbackURL  string
+	ExpiredPage  string
+	UTMSource    string
+	UTMMedium    string
+	UTMCampaign  string
+	RedirectType string
+	Password     string // visitors must enter it before being redirected
+	// QueryPassthrough merges the query string visitors arrive with into the destination, by one
+	// of the QueryPassthrough* policies; PathPassthrough appends path segments after the code
+	QueryPassthrough string
+	PathPassthrough  bool
+}
+
+// How incoming query params are merged into a destination that already has some of them
+const (
+	QueryPassthroughKeep     = "keep"     // the destination's value wins
+	QueryPassthroughOverride = "override" // the incoming value replaces the destination's
+	QueryPassthroughAppend   = "append"   // both are kept
+)
+
+// How a link sends visitors on: an HTTP status or an HTML page that redirects from the browser
+const (
+	RedirectMovedPermanently = "301"
+	RedirectFound            = "302"
+	RedirectTemporary        = "307"
+	RedirectPermanent        = "308"
+	RedirectHTML             = "html"
+	DefaultRedirectType      = RedirectFound
+)
+
+// RedirectTarget is where a followed link leads and how to get there. MaxAge is how long clients
+// may cache a permanent redirect; zero means the redirect must not be cached.
+type RedirectTarget struct {
+	URL    string
+	Type   string
+	MaxAge time.Duration
+	// VariantID is the A/B variant the visitor was sent to, 0 for none, and VisitorID the ID it was
+	// picked for; visitors who didn't send one should keep it to stay on the same variant
+	VariantID uint
+	VisitorID string
 }
 
 // URLService interface
 type URLService interface {
 	Shorten(originalURL string) (string, error)
 	ShortenForUser(originalURL string, userID uint) (string, error)
-	Redirect(shortURL string) (string, error)
+	Redirect(shortURL string, visit Visit) (string, error)
+	// Follow is Redirect that also tells how the link wants to be redirected
+	Follow(shortURL string, visit Visit) (*RedirectTarget, error)
+	// Preview resolves a link like Redirect, without following it or counting a click
+	Preview(shortURL string, visit Visit) (*model.URL, error)
+	// Unlock checks the password of a protected link and returns a short-lived token to pass as
+	// Visit.UnlockToken; clientIP is used to rate-limit failed attempts
+	Unlock(shortURL, password, clientIP string) (string, error)
 	GetURLsByUser(userID uint) ([]model.URL, error)
 	GetStats(shortURL string) (*model.URL, error)
+	GetClickSeries(shortURL string, interval string, from, to time.Time, loc *time.Location) ([]ClickBucket, error)
+	GetBreakdowns(shortURL string) (*Breakdowns, error)
 	ShortenWithOptions(originalURL string, userID uint, customAlias string, expiration *time.Time, maxClicks *uint64, utmSource, utmMedium, utmCampaign string) (string, error)
+	ShortenLink(opts ShortenOptions) (string, error)
+	UpdateLink(id, userID uint, update LinkUpdate) (*model.URL, error)
+	DeleteLink(id, userID uint) error
+	RestoreLink(id, userID uint) (*model.URL, error)
+	PurgeDeletedLinks() (int, error)
+	LinkDefaults(userID uint) (LinkDefaults, error)
+	SetLinkDefaults(userID uint, defaults LinkDefaults) (LinkDefaults, error)
+	ListRules(linkID, userID uint) ([]model.RedirectRule, error)
+	// AddRule inserts rule at rule.Position, or appends it when the position is 0
+	AddRule(linkID, userID uint, rule model.RedirectRule) (*model.RedirectRule, error)
+	UpdateRule(linkID, ruleID, userID uint, rule model.RedirectRule) (*model.RedirectRule, error)
+	DeleteRule(linkID, ruleID, userID uint) error
+	ListVariants(linkID, userID uint) ([]model.LinkVariant, error)
+	AddVariant(linkID, userID uint, variant model.LinkVariant) (*model.LinkVariant, error)
+	UpdateVariant(linkID, variantID, userID uint, variant model.LinkVariant) (*model.LinkVariant, error)
+	DeleteVariant(linkID, variantID, userID uint) error
+	// GetVariantStats reports the traffic share and recorded clicks of each A/B variant of a link
+	GetVariantStats(shortURL string) ([]VariantStats, error)
+}
+
+// VariantRepository stores the A/B variants of links
+type VariantRepository interface {
+	FindByURLID(urlID uint) ([]model.LinkVariant, error)
+	FindByID(id uint) (*model.LinkVariant, error)
+	Save(variant *model.LinkVariant) error
+	Update(variant *model.LinkVariant) error
+	Delete(id uint) error
+}
+
+// VariantStats is one A/B variant with its configured share of visitors and the clicks it got
+type VariantStats struct {
+	Variant       model.LinkVariant
+	WeightPercent float64
+	Clicks        uint64
+	ClickPercent  float64
+}
+
+// RuleRepository stores the redirect rules of links
+type RuleRepository interface {
+	// FindByURLID returns the rules of a link in the order they are tried
+	FindByURLID(urlID uint) ([]model.RedirectRule, error)
+	FindByID(id uint) (*model.RedirectRule, error)
+	Save(rule *model.RedirectRule) error
+	Update(rule *model.RedirectRule) error
+	Delete(id uint) error
+	// Reorder sets the positions of a link's rules to follow the order of ids
+	Reorder(urlID uint, ids []uint) error
+}
+
+// LinkDefaults are a user's settings for links that don't set their own
+type LinkDefaults struct {
+	FallbackURL string
+	ExpiredPage string
+}
+
+// LinkDefaultsRepository stores LinkDefaults per user
+type LinkDefaultsRepository interface {
+	LinkDefaults(userID uint) (LinkDefaults, error)
+	SetLinkDefaults(userID uint, defaults LinkDefaults) error
+}
+
+// CodeGenerator produces short codes. attempt counts the codes already found taken for the same
+// link, so deterministic strategies can derive a different one.
+type CodeGenerator interface {
+	Generate(originalURL string, attempt int) (string, error)
+}
+
+// SequenceRepository hands out increasing values per name that are never handed out twice
+type SequenceRepository interface {
+	Next(name string) (uint64, error)
+}
+
+// ReservedWords tells whether a word is unavailable as an alias or code, e.g. because a route uses it
+type ReservedWords interface {
+	IsReserved(alias string) bool
+}
+
+// DestinationValidator checks a destination URL and returns its normalized form
+type DestinationValidator interface {
+	Normalize(raw string) (string, error)
+}
+
+// SafetyVerdict is the result of a safety check; Reason explains a flag to the visitor
+type SafetyVerdict struct {
+	Unsafe bool
+	Reason string
+}
+
+// URLSafetyChecker flags destinations that are known or likely to be malicious
+type URLSafetyChecker interface {
+	Check(destination string) (SafetyVerdict, error)
 }
@@ -0,0 +1,85 @@
+// Package geoip resolves IP addresses to country and city using a local MaxMind DB (mmdb) file,
+// such as a GeoIP2 or GeoLite2 Country or City database.
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is the geography stored for a network
+type Location struct {
+	CountryCode string
+	Country     string
+	City        string
+}
+
+// record is the part of a Country or City record that is decoded
+type record struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Reader looks up addresses in an mmdb file
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// Open loads the database at path
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// FromBytes parses an in-memory database
+func FromBytes(buf []byte) (*Reader, error) {
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Close releases the database
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// Lookup returns the location of ip; ok is false when the database has no entry for it
+func (r *Reader) Lookup(ip net.IP) (Location, bool, error) {
+	if ip.To4() == nil && r.db.Metadata.IPVersion == 4 {
+		return Location{}, false, nil
+	}
+	var rec record
+	_, ok, err := r.db.LookupNetwork(ip, &rec)
+	if err != nil || !ok {
+		return Location{}, false, err
+	}
+	return Location{
+		CountryCode: rec.Country.ISOCode,
+		Country:     rec.Country.Names["en"],
+		City:        rec.City.Names["en"],
+	}, true, nil
+}
+
+// Locate resolves ip to an ISO country code and English city name; lookups that fail or miss return ok=false
+func (r *Reader) Locate(ip string) (string, string, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", "", false
+	}
+	loc, ok, err := r.Lookup(parsed)
+	if err != nil || !ok {
+		return "", "", false
+	}
+	return loc.CountryCode, loc.City, true
+}
@@ -0,0 +1,147 @@
+package geoip_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"url-shortener/internal/geoip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encode writes v in the mmdb data section format
+func encode(v any) []byte {
+	var b bytes.Buffer
+	switch x := v.(type) {
+	case string:
+		b.WriteByte(2<<5 | byte(len(x)))
+		b.WriteString(x)
+	case uint16:
+		b.WriteByte(5<<5 | 2)
+		binary.Write(&b, binary.BigEndian, x)
+	case uint32:
+		b.WriteByte(6<<5 | 4)
+		binary.Write(&b, binary.BigEndian, x)
+	case uint64:
+		b.WriteByte(8)
+		b.WriteByte(9 - 7)
+		binary.Write(&b, binary.BigEndian, x)
+	case map[string]any:
+		b.WriteByte(7<<5 | byte(len(x)))
+		for k, val := range x {
+			b.Write(encode(k))
+			b.Write(encode(val))
+		}
+	}
+	return b.Bytes()
+}
+
+type network struct {
+	cidr string
+	data map[string]any
+}
+
+// buildDB writes a database with 24-bit records for the given networks
+func buildDB(t *testing.T, ipVersion int, networks []network) []byte {
+	type node [2]int // >0 child node, 0 empty, <0 -(data index + 1)
+	nodes := []node{{}}
+	var data bytes.Buffer
+	var offsets []int
+	for _, n := range networks {
+		_, ipnet, err := net.ParseCIDR(n.cidr)
+		require.NoError(t, err)
+		ip := []byte(ipnet.IP)
+		ones, _ := ipnet.Mask.Size()
+		if ipVersion == 6 && len(ip) == net.IPv4len {
+			ip = append(make([]byte, 12), ip...)
+			ones += 96
+		}
+		offsets = append(offsets, data.Len())
+		data.Write(encode(n.data))
+		cur := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[cur][bit] = -len(offsets)
+				break
+			}
+			if nodes[cur][bit] <= 0 {
+				nodes = append(nodes, node{})
+				nodes[cur][bit] = len(nodes) - 1
+			}
+			cur = nodes[cur][bit]
+		}
+	}
+
+	count := len(nodes)
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for _, rec := range n {
+			v := count
+			if rec > 0 {
+				v = rec
+			} else if rec < 0 {
+				v = count + 16 + offsets[-rec-1]
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	out.Write(encode(map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(ipVersion),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16(2),
+		"build_epoch":                 uint64(1700000000),
+	}))
+	return out.Bytes()
+}
+
+func city(code, country, name string) map[string]any {
+	m := map[string]any{
+		"country": map[string]any{"iso_code": code, "names": map[string]any{"en": country}},
+	}
+	if name != "" {
+		m["city"] = map[string]any{"names": map[string]any{"en": name}}
+	}
+	return m
+}
+
+func TestLookup(t *testing.T) {
+	networks := []network{
+		{"203.0.113.0/24", city("MD", "Moldova", "Chisinau")},
+		{"198.51.100.0/25", city("US", "United States", "")},
+	}
+	for _, version := range []int{4, 6} {
+		r, err := geoip.FromBytes(buildDB(t, version, networks))
+		require.NoError(t, err)
+
+		loc, ok, err := r.Lookup(net.ParseIP("203.0.113.77"))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, geoip.Location{CountryCode: "MD", Country: "Moldova", City: "Chisinau"}, loc)
+
+		code, name, ok := r.Locate("198.51.100.1")
+		assert.True(t, ok)
+		assert.Equal(t, "US", code)
+		assert.Empty(t, name)
+
+		_, _, ok = r.Locate("198.51.100.200")
+		assert.False(t, ok)
+		_, _, ok = r.Locate("2001:db8::1")
+		assert.False(t, ok)
+		_, _, ok = r.Locate("not-an-ip")
+		assert.False(t, ok)
+	}
+}
+
+func TestFromBytesRejectsGarbage(t *testing.T) {
+	_, err := geoip.FromBytes([]byte("definitely not a database"))
+	assert.Error(t, err)
+}
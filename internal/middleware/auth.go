@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"strings"
@@ -13,7 +14,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+			unauthorized(w, r, "Missing or invalid token")
 			return
 		}
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
@@ -21,17 +22,17 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return jwtKey, nil
 		})
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			unauthorized(w, r, "Invalid token")
 			return
 		}
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			unauthorized(w, r, "Invalid token claims")
 			return
 		}
 		userIDFloat, ok := claims["user_id"].(float64)
 		if !ok {
-			http.Error(w, "Invalid user id in token", http.StatusUnauthorized)
+			unauthorized(w, r, "Invalid user id in token")
 			return
 		}
 		// Attach userID to context
@@ -42,6 +43,29 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// OptionalAuth attaches the caller's user ID like AuthMiddleware when a token is sent, and lets
+// anonymous requests through; invalid tokens are still rejected
+func OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		AuthMiddleware(next).ServeHTTP(w, r)
+	})
+}
+
+// unauthorized writes a 401 in the same JSON shape as api.ErrorResponse, which this package can't import
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id,omitempty"`
+	}{"unauthorized", message, RequestIDFromContext(r.Context())})
+}
+
 // Helper to set/get userID in context
 
 type contextKey string
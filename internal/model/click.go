@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// swagger:model Click
+type Click struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	URLID          uint      `gorm:"index;not null" json:"url_id"`                   // Short URL that was followed
+	ClickedAt      time.Time `gorm:"index;not null" json:"clicked_at"`               // Timestamp of the click
+	Referrer       string    `gorm:"size:2048" json:"referrer,omitempty"`            // Referer header
+	UserAgent      string    `gorm:"size:1024" json:"user_agent,omitempty"`          // User-Agent header
+	IPHash         string    `gorm:"size:64" json:"ip_hash,omitempty"`               // Keyed SHA-256 of the client IP
+	AcceptLanguage string    `gorm:"size:255" json:"accept_language,omitempty"`      // Accept-Language header
+	ReferrerDomain string    `gorm:"size:255" json:"referrer_domain,omitempty"`      // Referrer host without "www."
+	Device         string    `gorm:"size:16" json:"device,omitempty"`                // desktop, mobile, tablet, bot or unknown
+	Browser        string    `gorm:"size:64" json:"browser,omitempty"`               // Browser family
+	OS             string    `gorm:"size:64" json:"os,omitempty"`                    // Operating system family
+	Country        string    `gorm:"size:2" json:"country,omitempty"`                // ISO country code from GeoIP
+	City           string    `gorm:"size:255" json:"city,omitempty"`                 // City name from GeoIP
+	VariantID      uint      `gorm:"not null;default:0" json:"variant_id,omitempty"` // A/B variant the visitor was sent to, 0 for none
+}
+
+// TableName overrides the default table name for Click.
+func (Click) TableName() string {
+	return "clicks"
+}
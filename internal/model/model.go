@@ -7,6 +7,9 @@ type User struct {
 	Username  string    `json:"username"`
 	Password  string    `json:"-"` // store hashed password
 	CreatedAt time.Time `json:"created_at"`
+	// Defaults for links that don't set their own fallback once expired or out of clicks
+	FallbackURL string `json:"fallback_url,omitempty"`
+	ExpiredPage string `gorm:"type:text" json:"expired_page,omitempty"`
 }
 
 type ShortURModel struct {
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// RedirectRule sends matching visitors of a link to another destination. Rules are tried in
+// Position order and the first match wins; visitors matching none go to the link's OriginalURL.
+// Every condition that is set must match; list conditions match any of their values.
+// swagger:model RedirectRule
+type RedirectRule struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	URLID       uint       `gorm:"index;not null" json:"url_id"`                                 // Link the rule belongs to
+	Position    int        `gorm:"not null" json:"position"`                                     // Order in which rules are tried, starting at 1
+	Destination string     `gorm:"not null" json:"destination"`                                  // Where matching visitors go
+	Devices     []string   `gorm:"serializer:json" json:"devices,omitempty"`                     // desktop, mobile, tablet or bot
+	OS          []string   `gorm:"serializer:json" json:"os,omitempty"`                          // Operating system families, e.g. iOS or Android
+	Languages   []string   `gorm:"serializer:json" json:"languages,omitempty"`                   // Language tags matched against the preferred Accept-Language, e.g. de or pt-BR
+	Countries   []string   `gorm:"serializer:json" json:"countries,omitempty"`                   // ISO country codes from GeoIP
+	TimeFrom    string     `gorm:"size:5" json:"time_from,omitempty" example:"09:00"`            // Start of the daily window, HH:MM
+	TimeTo      string     `gorm:"size:5" json:"time_to,omitempty" example:"17:30"`              // End of the daily window, exclusive; before TimeFrom wraps past midnight
+	TimeZone    string     `gorm:"size:64" json:"time_zone,omitempty" example:"Europe/Chisinau"` // IANA zone of the daily window, UTC by default
+	StartsAt    *time.Time `json:"starts_at,omitempty"`                                          // Start of the date range
+	EndsAt      *time.Time `json:"ends_at,omitempty"`                                            // End of the date range, exclusive
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName overrides the default table name for RedirectRule.
+func (RedirectRule) TableName() string {
+	return "redirect_rules"
+}
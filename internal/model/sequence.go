@@ -0,0 +1,12 @@
+package model
+
+// Sequence is a named counter handing out increasing values, such as the numbers behind sequence short codes
+type Sequence struct {
+	Name  string `gorm:"primaryKey;size:64" json:"name"`
+	Value uint64 `gorm:"not null;default:0" json:"value"` // Last value handed out
+}
+
+// TableName overrides the default table name for Sequence.
+func (Sequence) TableName() string {
+	return "sequences"
+}
@@ -1,25 +1,89 @@
 package model
 
 import (
-	//"gorm.io/gorm"
+	"encoding/json"
+	"gorm.io/gorm"
 	"time"
 )
 
+// Link states, derived from the schedule, limits and deletion of a link
+const (
+	LinkStateScheduled = "scheduled"
+	LinkStateActive    = "active"
+	LinkStateExpired   = "expired"
+	LinkStateExhausted = "exhausted"
+	LinkStateDeleted   = "deleted"
+)
+
 // swagger:model URL
 type URL struct {
-	ID            uint       `gorm:"primaryKey" json:"id"`
-	ShortenedURL  string     `gorm:"uniqueIndex;not null" json:"shortened_url"`          // Shortened URL
-	OriginalURL   string     `gorm:"not null" json:"original_url"`                       // Original URL
-	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`                   // Timestamp of creation
-	UserID        uint       `gorm:"index" json:"user_id"`                               // User association
-	ClickCount    uint64     `gorm:"default:0" json:"click_count"`                       // Number of clicks
-	LastClickedAt *time.Time `json:"last_clicked_at"`                                    // Timestamp of last click
-	CustomAlias   string     `gorm:"uniqueIndex;size:255" json:"custom_alias,omitempty"` // Optional custom alias
-	Expiration    *time.Time `json:"expiration,omitempty"`                               // Optional link expiration
-	MaxClicks     *uint64    `json:"max_clicks,omitempty"`                               // Optional click limit
-	UTMSource     string     `gorm:"size:255" json:"utm_source,omitempty"`               // Optional UTM source
-	UTMMedium     string     `gorm:"size:255" json:"utm_medium,omitempty"`               // Optional UTM medium
-	UTMCampaign   string     `gorm:"size:255" json:"utm_campaign,omitempty"`             // Optional UTM campaign
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	ShortenedURL       string         `gorm:"uniqueIndex;not null" json:"shortened_url"`                                                               // Shortened URL
+	OriginalURL        string         `gorm:"not null" json:"original_url"`                                                                            // Original URL
+	CreatedAt          time.Time      `gorm:"autoCreateTime" json:"created_at"`                                                                        // Timestamp of creation
+	UserID             uint           `gorm:"index" json:"user_id"`                                                                                    // User association
+	ClickCount         uint64         `gorm:"default:0" json:"click_count"`                                                                            // Number of clicks
+	LastClickedAt      *time.Time     `json:"last_clicked_at"`                                                                                         // Timestamp of last click
+	CustomAlias        string         `gorm:"uniqueIndex:idx_short_urls_custom_alias,where:custom_alias <> '';size:255" json:"custom_alias,omitempty"` // Optional custom alias, folded when alias folding is enabled
+	CustomAliasDisplay string         `gorm:"size:255" json:"custom_alias_display,omitempty"`                                                          // Custom alias as typed by the owner
+	ActivatesAt        *time.Time     `json:"activates_at,omitempty"`                                                                                  // Optional start; before it the link is "coming soon"
+	ComingSoonURL      string         `json:"coming_soon_url,omitempty"`                                                                               // Where to send visitors before ActivatesAt
+	Expiration         *time.Time     `json:"expiration,omitempty"`                                                                                    // Optional link expiration
+	MaxClicks          *uint64        `json:"max_clicks,omitempty"`                                                                                    // Optional click limit
+	FallbackURL        string         `json:"fallback_url,omitempty"`                                                                                  // Where to send visitors once the link expired or ran out of clicks
+	ExpiredPage        string         `gorm:"type:text" json:"expired_page,omitempty"`                                                                 // Custom HTML shown instead, when there's no fallback URL
+	UTMSource          string         `gorm:"size:255" json:"utm_source,omitempty"`                                                                    // Optional UTM source
+	UTMMedium          string         `gorm:"size:255" json:"utm_medium,omitempty"`                                                                    // Optional UTM medium
+	UTMCampaign        string         `gorm:"size:255" json:"utm_campaign,omitempty"`                                                                  // Optional UTM campaign
+	Title              string         `gorm:"size:255" json:"title,omitempty"`                                                                         // Optional title shown on the preview page
+	ForcePreview       bool           `gorm:"not null;default:false" json:"force_preview"`                                                             // Show the preview page before every redirect
+	RedirectType       string         `gorm:"size:8" json:"redirect_type,omitempty"`                                                                   // 301, 302, 307, 308 or html; empty means 302
+	QueryPassthrough   string         `gorm:"size:16" json:"query_passthrough,omitempty"`                                                              // keep, override or append incoming query params; empty drops them
+	PathPassthrough    bool           `gorm:"not null;default:false" json:"path_passthrough"`                                                          // Append path segments after the code to the destination
+	HasRules           bool           `gorm:"not null;default:false" json:"has_rules"`                                                                 // Visitors are routed by RedirectRules before falling back to OriginalURL
+	HasVariants        bool           `gorm:"not null;default:false" json:"has_variants"`                                                              // Visitors not routed by a rule are split over LinkVariants
+	PasswordHash       string         `gorm:"size:255" json:"-"`                                                                                       // bcrypt hash of the optional link password
+	Quarantined        bool           `gorm:"not null;default:false" json:"quarantined"`                                                               // Flagged by a safety check; served behind a warning
+	QuarantineReason   string         `gorm:"size:255" json:"quarantine_reason,omitempty"`                                                             // Why the link was flagged
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"deleted_at"`                                                                                 // Soft-delete timestamp
+	State              string         `gorm:"-" json:"state" enums:"scheduled,active,expired,exhausted,deleted"`                                       // Filled in when encoding to JSON, see StateAt
+	Rules              []RedirectRule `gorm:"-" json:"-"`                                                                                              // Loaded with lookups by code or alias when HasRules is set
+	Variants           []LinkVariant  `gorm:"-" json:"-"`                                                                                              // Loaded with lookups by code or alias when HasVariants is set
+}
+
+// DisplayAlias returns the custom alias with the casing its owner chose
+func (u *URL) DisplayAlias() string {
+	if u.CustomAliasDisplay != "" {
+		return u.CustomAliasDisplay
+	}
+	return u.CustomAlias
+}
+
+// HasPassword reports whether visitors must enter a password before being redirected
+func (u *URL) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// StateAt tells whether the link can be followed at now, and if not, why
+func (u *URL) StateAt(now time.Time) string {
+	switch {
+	case u.DeletedAt.Valid:
+		return LinkStateDeleted
+	case u.Expiration != nil && now.After(*u.Expiration):
+		return LinkStateExpired
+	case u.MaxClicks != nil && u.ClickCount >= *u.MaxClicks:
+		return LinkStateExhausted
+	case u.ActivatesAt != nil && now.Before(*u.ActivatesAt):
+		return LinkStateScheduled
+	}
+	return LinkStateActive
+}
+
+// MarshalJSON includes the current state, so listings and stats show it
+func (u URL) MarshalJSON() ([]byte, error) {
+	type plain URL
+	u.State = u.StateAt(time.Now())
+	return json.Marshal(plain(u))
 }
 
 // TableName overrides the default table name for URL.
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// LinkVariant is one destination of an A/B split. Visitors of a link with variants are spread over
+// them in proportion to their weights, and each visitor keeps getting the same one.
+// swagger:model LinkVariant
+type LinkVariant struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	URLID       uint      `gorm:"index;not null" json:"url_id"`               // Link the variant belongs to
+	Label       string    `gorm:"size:64" json:"label,omitempty" example:"B"` // Name shown in stats
+	Destination string    `gorm:"not null" json:"destination"`                // Where visitors given this variant go
+	Weight      int       `gorm:"not null" json:"weight" example:"30"`        // Relative share of visitors
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName overrides the default table name for LinkVariant.
+func (LinkVariant) TableName() string {
+	return "link_variants"
+}
@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// CacheStats reports cache effectiveness for monitoring
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// CachedURLRepository is a size-bounded LRU with TTL in front of short code and alias lookups.
+// Unknown codes are cached too (negative caching) so scans for random codes don't reach the database.
+type CachedURLRepository struct {
+	domain.URLRepository
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	byID    map[uint][]string
+	// gen counts invalidations; dropped and droppedKeys record when each link and key was last
+	// invalidated, so a lookup that raced with a change to its link doesn't store what it loaded
+	gen         uint64
+	dropped     map[uint]uint64
+	droppedKeys map[string]uint64
+	inflight    map[uint64]int // lookups in progress by the gen they started at
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	key     string
+	url     *model.URL // nil for a negative entry
+	expires time.Time
+}
+
+func NewCachedURLRepository(inner domain.URLRepository, size int, ttl, negativeTTL time.Duration) *CachedURLRepository {
+	return &CachedURLRepository{
+		URLRepository: inner,
+		ttl:           ttl,
+		negativeTTL:   negativeTTL,
+		size:          size,
+		order:         list.New(),
+		entries:       make(map[string]*list.Element),
+		byID:          make(map[uint][]string),
+		dropped:       make(map[uint]uint64),
+		droppedKeys:   make(map[string]uint64),
+		inflight:      make(map[uint64]int),
+	}
+}
+
+func (r *CachedURLRepository) FindByShortURL(shortURL string) (*model.URL, error) {
+	return r.lookup("code:"+shortURL, func() (*model.URL, error) {
+		return r.URLRepository.FindByShortURL(shortURL)
+	})
+}
+
+func (r *CachedURLRepository) FindByCustomAlias(alias string) (*model.URL, error) {
+	return r.lookup("alias:"+alias, func() (*model.URL, error) {
+		return r.URLRepository.FindByCustomAlias(alias)
+	})
+}
+
+func (r *CachedURLRepository) Save(url *model.URL) error {
+	if err := r.URLRepository.Save(url); err != nil {
+		return err
+	}
+	r.forgetMissing(url)
+	return nil
+}
+
+func (r *CachedURLRepository) Update(url *model.URL) error {
+	r.Invalidate(url.ID)
+	err := r.URLRepository.Update(url)
+	r.Invalidate(url.ID)
+	// A new code or alias may have been looked up, and cached as unknown, while checking it was free
+	r.forgetMissing(url)
+	return err
+}
+
+func (r *CachedURLRepository) SoftDelete(id uint) error {
+	err := r.URLRepository.SoftDelete(id)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *CachedURLRepository) Restore(id uint) error {
+	err := r.URLRepository.Restore(id)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *CachedURLRepository) Quarantine(id uint, reason string) error {
+	err := r.URLRepository.Quarantine(id, reason)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *CachedURLRepository) ClearQuarantine(id uint) error {
+	err := r.URLRepository.ClearQuarantine(id)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *CachedURLRepository) SetHasRules(id uint, hasRules bool) error {
+	err := r.URLRepository.SetHasRules(id, hasRules)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *CachedURLRepository) SetHasVariants(id uint, hasVariants bool) error {
+	err := r.URLRepository.SetHasVariants(id, hasVariants)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *CachedURLRepository) PurgeDeleted(cutoff time.Time) ([]uint, error) {
+	ids, err := r.URLRepository.PurgeDeleted(cutoff)
+	for _, id := range ids {
+		r.Invalidate(id)
+	}
+	return ids, err
+}
+
+// Invalidate drops every cached entry for the link with the given ID
+func (r *CachedURLRepository) Invalidate(id uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// remove edits r.byID[id], so iterate over a copy
+	for _, key := range append([]string(nil), r.byID[id]...) {
+		r.remove(key)
+	}
+	r.gen++
+	if len(r.inflight) > 0 {
+		r.dropped[id] = r.gen
+	}
+}
+
+// forgetMissing drops negative entries for the code and alias of url, which now exist
+func (r *CachedURLRepository) forgetMissing(url *model.URL) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gen++
+	keys := []string{"code:" + url.ShortenedURL}
+	if url.CustomAlias != "" {
+		keys = append(keys, "alias:"+url.CustomAlias)
+	}
+	for _, key := range keys {
+		r.remove(key)
+		if len(r.inflight) > 0 {
+			r.droppedKeys[key] = r.gen
+		}
+	}
+}
+
+// Stats returns hit and miss counters since startup
+func (r *CachedURLRepository) Stats() CacheStats {
+	r.mu.Lock()
+	entries := r.order.Len()
+	r.mu.Unlock()
+	return CacheStats{Hits: r.hits.Load(), Misses: r.misses.Load(), Entries: entries}
+}
+
+func (r *CachedURLRepository) lookup(key string, load func() (*model.URL, error)) (*model.URL, error) {
+	r.mu.Lock()
+	if el, ok := r.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			r.order.MoveToFront(el)
+			r.mu.Unlock()
+			r.hits.Add(1)
+			if entry.url == nil {
+				return nil, domain.ErrNotFound
+			}
+			cp := *entry.url
+			return &cp, nil
+		}
+		r.remove(key)
+	}
+	start := r.gen
+	r.inflight[start]++
+	r.mu.Unlock()
+	defer r.done(start)
+	r.misses.Add(1)
+
+	url, err := load()
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) && r.negativeTTL > 0 {
+			r.store(key, nil, r.negativeTTL, start)
+		}
+		return nil, err
+	}
+	cp := *url
+	r.store(key, &cp, r.ttl, start)
+	return url, nil
+}
+
+// store caches url under key unless its link or key was invalidated after the lookup started
+// at start: the loaded copy may predate that change
+func (r *CachedURLRepository) store(key string, url *model.URL, ttl time.Duration, start uint64) {
+	if r.size <= 0 || ttl <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.droppedKeys[key] > start || (url != nil && r.dropped[url.ID] > start) {
+		return
+	}
+	r.remove(key)
+	entry := &cacheEntry{key: key, url: url, expires: time.Now().Add(ttl)}
+	r.entries[key] = r.order.PushFront(entry)
+	if url != nil {
+		r.byID[url.ID] = append(r.byID[url.ID], key)
+	}
+	for r.order.Len() > r.size {
+		r.remove(r.order.Back().Value.(*cacheEntry).key)
+	}
+}
+
+// done ends a lookup that started at start and forgets invalidations no running lookup can race with
+func (r *CachedURLRepository) done(start uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inflight[start]--; r.inflight[start] == 0 {
+		delete(r.inflight, start)
+	}
+	if len(r.inflight) == 0 {
+		clear(r.dropped)
+		clear(r.droppedKeys)
+		return
+	}
+	if len(r.dropped)+len(r.droppedKeys) < r.size {
+		return
+	}
+	oldest := r.gen
+	for gen := range r.inflight {
+		oldest = min(oldest, gen)
+	}
+	for id, gen := range r.dropped {
+		if gen <= oldest {
+			delete(r.dropped, id)
+		}
+	}
+	for key, gen := range r.droppedKeys {
+		if gen <= oldest {
+			delete(r.droppedKeys, key)
+		}
+	}
+}
+
+// remove deletes a single key; callers hold r.mu
+func (r *CachedURLRepository) remove(key string) {
+	el, ok := r.entries[key]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*cacheEntry)
+	r.order.Remove(el)
+	delete(r.entries, key)
+	if entry.url == nil {
+		return
+	}
+	keys := r.byID[entry.url.ID]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(r.byID, entry.url.ID)
+	} else {
+		r.byID[entry.url.ID] = keys
+	}
+}
@@ -0,0 +1,174 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedURLRepository(t *testing.T) {
+	db := setupDB(t)
+	cached := repository.NewCachedURLRepository(repository.NewURLRepository(db), 2, time.Minute, time.Minute)
+	svc := service.NewURLService(cached, repository.NewClickRepository(db))
+
+	token, err := svc.ShortenForUser("https://cache.com", 0)
+	assert.NoError(t, err)
+
+	// The negative entry stored while checking for collisions is dropped by Save
+	_, err = cached.FindByShortURL(token)
+	assert.NoError(t, err)
+	_, err = cached.FindByShortURL(token)
+	assert.NoError(t, err)
+	stats := cached.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+
+	// Unknown codes are cached negatively
+	_, err = cached.FindByShortURL("missing1")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = cached.FindByShortURL("missing1")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.Equal(t, stats.Hits+1, cached.Stats().Hits)
+
+	// Updates are visible immediately
+	urlObj, err := cached.FindByShortURL(token)
+	assert.NoError(t, err)
+	urlObj.OriginalURL = "https://cache.com/changed"
+	assert.NoError(t, cached.Update(urlObj))
+	dest, err := svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cache.com/changed", dest)
+
+	// Click counts are not served stale from the cache
+	stats2, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stats2.ClickCount)
+
+	// Size bound evicts the least recently used entry
+	assert.LessOrEqual(t, cached.Stats().Entries, 2)
+}
+
+// slowLookups holds FindByShortURL calls until released, to race them with invalidations
+type slowLookups struct {
+	domain.URLRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *slowLookups) FindByShortURL(shortURL string) (*model.URL, error) {
+	urlObj, err := r.URLRepository.FindByShortURL(shortURL)
+	if r.started != nil {
+		close(r.started)
+		r.started = nil
+		<-r.release
+	}
+	return urlObj, err
+}
+
+func TestCacheDropsLookupsRacingInvalidation(t *testing.T) {
+	db := setupDB(t)
+	inner := repository.NewURLRepository(db)
+	assert.NoError(t, inner.Save(&model.URL{ShortenedURL: "racy1234", OriginalURL: "https://old.com"}))
+	slow := &slowLookups{URLRepository: inner}
+	cached := repository.NewCachedURLRepository(slow, 100, time.Minute, time.Minute)
+
+	slow.started, slow.release = make(chan struct{}), make(chan struct{})
+	started := slow.started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cached.FindByShortURL("racy1234")
+	}()
+	<-started
+	// The link changes while the old copy is being loaded
+	urlObj, err := inner.FindByShortURL("racy1234")
+	assert.NoError(t, err)
+	urlObj.OriginalURL = "https://new.com"
+	assert.NoError(t, cached.Update(urlObj))
+	close(slow.release)
+	<-done
+
+	got, err := cached.FindByShortURL("racy1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://new.com", got.OriginalURL)
+}
+
+func TestRenameThroughCache(t *testing.T) {
+	db := setupDB(t)
+	cached := repository.NewCachedURLRepository(repository.NewURLRepository(db), 100, time.Minute, time.Minute)
+	svc := service.NewURLService(cached, repository.NewClickRepository(db))
+
+	token, err := svc.ShortenWithOptions("https://rename.com", 3, "oldname", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	urlObj, err := cached.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// Checking the new alias is free caches it as unknown; the rename must drop that entry
+	newName := "newname"
+	_, err = svc.UpdateLink(urlObj.ID, 3, domain.LinkUpdate{CustomAlias: &newName})
+	assert.NoError(t, err)
+	dest, err := svc.Redirect("newname", domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://rename.com", dest)
+	_, err = svc.Redirect("oldname", domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestCacheKeepsLookupsRacingOtherLinks(t *testing.T) {
+	db := setupDB(t)
+	inner := repository.NewURLRepository(db)
+	assert.NoError(t, inner.Save(&model.URL{ShortenedURL: "keep1234", OriginalURL: "https://keep.com"}))
+	other := &model.URL{ShortenedURL: "other123", OriginalURL: "https://other.com"}
+	assert.NoError(t, inner.Save(other))
+	slow := &slowLookups{URLRepository: inner}
+	cached := repository.NewCachedURLRepository(slow, 100, time.Minute, time.Minute)
+
+	slow.started, slow.release = make(chan struct{}), make(chan struct{})
+	started := slow.started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cached.FindByShortURL("keep1234")
+	}()
+	<-started
+	// A change to another link doesn't make this load stale
+	other.OriginalURL = "https://other.com/changed"
+	assert.NoError(t, cached.Update(other))
+	close(slow.release)
+	<-done
+
+	hits := cached.Stats().Hits
+	_, err := cached.FindByShortURL("keep1234")
+	assert.NoError(t, err)
+	assert.Equal(t, hits+1, cached.Stats().Hits)
+}
+
+func TestCacheKeepsLinksAcrossClicks(t *testing.T) {
+	db := setupDB(t)
+	cached := repository.NewCachedURLRepository(repository.NewURLRepository(db), 100, time.Minute, time.Minute)
+	limit := uint64(1)
+	urlObj := &model.URL{ShortenedURL: "click123", OriginalURL: "https://click.com", MaxClicks: &limit}
+	assert.NoError(t, cached.Save(urlObj))
+	_, err := cached.FindByShortURL("click123")
+	assert.NoError(t, err)
+
+	ok, err := cached.ConsumeClick(urlObj.ID, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, cached.IncrementClicks(map[uint]domain.ClickDelta{urlObj.ID: {Count: 1, LastClickedAt: time.Now()}}))
+
+	hits := cached.Stats().Hits
+	_, err = cached.FindByShortURL("click123")
+	assert.NoError(t, err)
+	assert.Equal(t, hits+1, cached.Stats().Hits)
+
+	// The limit is enforced by the database, not by the cached counter
+	ok, err = cached.ConsumeClick(urlObj.ID, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
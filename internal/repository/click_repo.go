@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+type clickRepository struct {
+	db *gorm.DB
+}
+
+func NewClickRepository(db *gorm.DB) domain.ClickRepository {
+	return &clickRepository{db: db}
+}
+
+func (r *clickRepository) Save(click *model.Click) error {
+	return dbError(r.db.Create(click).Error)
+}
+
+func (r *clickRepository) SaveBatch(clicks []model.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	return dbError(r.db.CreateInBatches(clicks, len(clicks)).Error)
+}
+
+func (r *clickRepository) FindByURLID(urlID uint) ([]model.Click, error) {
+	var clicks []model.Click
+	if err := r.db.Where("url_id = ?", urlID).Order("clicked_at").Find(&clicks).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return clicks, nil
+}
+
+func (r *clickRepository) CountBetween(urlID uint, from, to time.Time, slot time.Duration) ([]domain.ClickBucket, error) {
+	seconds := int64(slot / time.Second)
+	if seconds <= 0 {
+		return nil, errors.New("slot must be at least a second")
+	}
+	var rows []struct {
+		Slot  int64
+		Count uint64
+	}
+	err := r.db.Model(&model.Click{}).
+		Select(r.epochExpr()+" / ? * ? AS slot, COUNT(*) AS count", seconds, seconds).
+		Where("url_id = ? AND clicked_at >= ? AND clicked_at < ?", urlID, from, to).
+		Group("slot").
+		Order("slot").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, dbError(err)
+	}
+	counts := make([]domain.ClickBucket, len(rows))
+	for i, row := range rows {
+		counts[i] = domain.ClickBucket{Start: time.Unix(row.Slot, 0).UTC(), Count: row.Count}
+	}
+	return counts, nil
+}
+
+// epochExpr is clicked_at in whole Unix seconds; tests run on SQLite, production on Postgres
+func (r *clickRepository) epochExpr() string {
+	if r.db.Dialector.Name() == "sqlite" {
+		return "CAST(strftime('%s', clicked_at) AS INTEGER)"
+	}
+	return "CAST(FLOOR(EXTRACT(EPOCH FROM clicked_at)) AS BIGINT)"
+}
+
+func (r *clickRepository) CountBy(urlID uint, field string, limit int) ([]domain.ValueCount, error) {
+	switch field {
+	case domain.ClickFieldReferrerDomain, domain.ClickFieldDevice, domain.ClickFieldBrowser, domain.ClickFieldOS,
+		domain.ClickFieldCountry, domain.ClickFieldCity, domain.ClickFieldVariant:
+	default:
+		// field is interpolated into the query, so only known columns are allowed
+		return nil, errors.New("unsupported click field")
+	}
+	var rows []struct {
+		Value string
+		Count uint64
+	}
+	query := r.db.Model(&model.Click{}).
+		Select(field+" AS value, COUNT(*) AS count").
+		Where("url_id = ?", urlID).
+		Group(field).
+		Order("count DESC, value")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, dbError(err)
+	}
+	counts := make([]domain.ValueCount, len(rows))
+	for i, row := range rows {
+		counts[i] = domain.ValueCount{Value: row.Value, Count: row.Count}
+	}
+	return counts, nil
+}
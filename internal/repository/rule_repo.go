@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+type ruleRepository struct {
+	db *gorm.DB
+}
+
+func NewRuleRepository(db *gorm.DB) domain.RuleRepository {
+	return &ruleRepository{db: db}
+}
+
+func (r *ruleRepository) FindByURLID(urlID uint) ([]model.RedirectRule, error) {
+	var rules []model.RedirectRule
+	if err := r.db.Where("url_id = ?", urlID).Order("position, id").Find(&rules).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return rules, nil
+}
+
+func (r *ruleRepository) FindByID(id uint) (*model.RedirectRule, error) {
+	var rule model.RedirectRule
+	if err := r.db.First(&rule, id).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return &rule, nil
+}
+
+func (r *ruleRepository) Save(rule *model.RedirectRule) error {
+	return dbError(r.db.Create(rule).Error)
+}
+
+func (r *ruleRepository) Update(rule *model.RedirectRule) error {
+	return dbError(r.db.Save(rule).Error)
+}
+
+func (r *ruleRepository) Delete(id uint) error {
+	return dbError(r.db.Delete(&model.RedirectRule{}, id).Error)
+}
+
+func (r *ruleRepository) Reorder(urlID uint, ids []uint) error {
+	return dbError(r.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			err := tx.Model(&model.RedirectRule{}).Where("id = ? AND url_id = ?", id, urlID).Update("position", i+1).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+type sequenceRepository struct {
+	db *gorm.DB
+}
+
+func NewSequenceRepository(db *gorm.DB) domain.SequenceRepository {
+	return &sequenceRepository{db: db}
+}
+
+// Next increments the counter in a single statement, so concurrent callers never see the same value
+func (r *sequenceRepository) Next(name string) (uint64, error) {
+	for {
+		var values []uint64
+		err := r.db.Raw("UPDATE sequences SET value = value + 1 WHERE name = ? RETURNING value", name).Scan(&values).Error
+		if err != nil {
+			return 0, dbError(err)
+		}
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		// First use of this sequence
+		err = r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.Sequence{Name: name}).Error
+		if err != nil {
+			return 0, dbError(err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"time"
+	"url-shortener/internal/cache"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// InvalidationChannel carries the IDs of links whose cached copies must be dropped
+const InvalidationChannel = "url-shortener:invalidate"
+
+// notFoundMarker is cached for codes that don't exist
+var notFoundMarker = []byte("-")
+
+// generationKey holds a value that changes whenever cached links are dropped, see store
+const generationKey = "url:generation"
+
+// SharedURLRepository resolves short codes through a cache shared by all replicas. Every link is
+// cached under its code, its alias and its ID; the ID entry lets an edit find and drop the others.
+// Edits are also published on InvalidationChannel so replicas can flush their local caches.
+type SharedURLRepository struct {
+	domain.URLRepository
+	cache       cache.Cache
+	pubsub      cache.PubSub
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// NewSharedURLRepository wraps inner with c; pubsub may be nil when there is nothing to notify
+func NewSharedURLRepository(inner domain.URLRepository, c cache.Cache, pubsub cache.PubSub, ttl, negativeTTL time.Duration) *SharedURLRepository {
+	return &SharedURLRepository{
+		URLRepository: inner,
+		cache:         c,
+		pubsub:        pubsub,
+		ttl:           ttl,
+		negativeTTL:   negativeTTL,
+	}
+}
+
+func (r *SharedURLRepository) FindByShortURL(shortURL string) (*model.URL, error) {
+	return r.lookup(codeKey(shortURL), func() (*model.URL, error) {
+		return r.URLRepository.FindByShortURL(shortURL)
+	})
+}
+
+func (r *SharedURLRepository) FindByCustomAlias(alias string) (*model.URL, error) {
+	return r.lookup(aliasKey(alias), func() (*model.URL, error) {
+		return r.URLRepository.FindByCustomAlias(alias)
+	})
+}
+
+func (r *SharedURLRepository) Save(url *model.URL) error {
+	if err := r.URLRepository.Save(url); err != nil {
+		return err
+	}
+	r.bumpGeneration()
+	r.delete(nameKeys(url)...)
+	return nil
+}
+
+func (r *SharedURLRepository) Update(url *model.URL) error {
+	err := r.URLRepository.Update(url)
+	r.Invalidate(url.ID)
+	// A new code or alias may have been cached as unknown while checking it was free
+	r.delete(nameKeys(url)...)
+	return err
+}
+
+func (r *SharedURLRepository) SoftDelete(id uint) error {
+	err := r.URLRepository.SoftDelete(id)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *SharedURLRepository) Restore(id uint) error {
+	err := r.URLRepository.Restore(id)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *SharedURLRepository) Quarantine(id uint, reason string) error {
+	err := r.URLRepository.Quarantine(id, reason)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *SharedURLRepository) ClearQuarantine(id uint) error {
+	err := r.URLRepository.ClearQuarantine(id)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *SharedURLRepository) SetHasRules(id uint, hasRules bool) error {
+	err := r.URLRepository.SetHasRules(id, hasRules)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *SharedURLRepository) SetHasVariants(id uint, hasVariants bool) error {
+	err := r.URLRepository.SetHasVariants(id, hasVariants)
+	r.Invalidate(id)
+	return err
+}
+
+func (r *SharedURLRepository) PurgeDeleted(cutoff time.Time) ([]uint, error) {
+	ids, err := r.URLRepository.PurgeDeleted(cutoff)
+	for _, id := range ids {
+		r.Invalidate(id)
+	}
+	return ids, err
+}
+
+// Invalidate drops the shared entries for a link and tells every replica to do the same
+func (r *SharedURLRepository) Invalidate(id uint) {
+	r.bumpGeneration()
+	r.forget(id)
+	if r.pubsub == nil {
+		return
+	}
+	if err := r.pubsub.Publish(InvalidationChannel, strconv.FormatUint(uint64(id), 10)); err != nil {
+		log.Printf("failed to publish invalidation for url %d: %v", id, err)
+	}
+}
+
+// forget drops every Redis key cached for a link
+func (r *SharedURLRepository) forget(id uint) {
+	raw, ok, err := r.cache.Get(idKey(id))
+	if err != nil || !ok {
+		return
+	}
+	var cached model.URL
+	if decodeURL(raw, &cached) != nil {
+		r.delete(idKey(id))
+		return
+	}
+	r.delete(keysFor(&cached)...)
+}
+
+func (r *SharedURLRepository) lookup(key string, load func() (*model.URL, error)) (*model.URL, error) {
+	raw, ok, err := r.cache.Get(key)
+	if err != nil {
+		log.Printf("shared cache read failed: %v", err)
+	}
+	if err == nil && ok {
+		if string(raw) == string(notFoundMarker) {
+			return nil, domain.ErrNotFound
+		}
+		var url model.URL
+		if decodeURL(raw, &url) == nil {
+			return &url, nil
+		}
+	}
+
+	gen := r.generation()
+	url, err := load()
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) && r.negativeTTL > 0 {
+			r.store([]string{key}, notFoundMarker, r.negativeTTL, gen)
+		}
+		return nil, err
+	}
+	if raw, err := encodeURL(url); err == nil {
+		r.store(keysFor(url), raw, r.ttl, gen)
+	}
+	return url, nil
+}
+
+// store caches value under keys, then drops it again if cached links were dropped since gen was
+// read: the loaded copy may predate that edit. Edits bump the generation before deleting, so
+// either their delete comes after the write or the write sees the new generation.
+func (r *SharedURLRepository) store(keys []string, value []byte, ttl time.Duration, gen string) {
+	for _, k := range keys {
+		r.set(k, value, ttl)
+	}
+	if r.generation() != gen {
+		r.delete(keys...)
+	}
+}
+
+func (r *SharedURLRepository) generation() string {
+	raw, ok, err := r.cache.Get(generationKey)
+	if err != nil || !ok {
+		return ""
+	}
+	return string(raw)
+}
+
+func (r *SharedURLRepository) bumpGeneration() {
+	r.set(generationKey, []byte(strconv.FormatUint(rand.Uint64(), 36)), 0)
+}
+
+// encodeURL serializes every column of a link. JSON would drop fields kept out of API responses,
+// such as the password hash; entries in an older format simply fail to decode and are reloaded.
+func encodeURL(url *model.URL) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(url); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeURL(raw []byte, url *model.URL) error {
+	return gob.NewDecoder(bytes.NewReader(raw)).Decode(url)
+}
+
+func (r *SharedURLRepository) set(key string, value []byte, ttl time.Duration) {
+	if err := r.cache.Set(key, value, ttl); err != nil {
+		log.Printf("shared cache write failed: %v", err)
+	}
+}
+
+func (r *SharedURLRepository) delete(keys ...string) {
+	if err := r.cache.Delete(keys...); err != nil {
+		log.Printf("shared cache delete failed: %v", err)
+	}
+}
+
+func keysFor(url *model.URL) []string {
+	return append([]string{idKey(url.ID)}, nameKeys(url)...)
+}
+
+// nameKeys are the keys a link is looked up by
+func nameKeys(url *model.URL) []string {
+	keys := []string{codeKey(url.ShortenedURL)}
+	if url.CustomAlias != "" {
+		keys = append(keys, aliasKey(url.CustomAlias))
+	}
+	return keys
+}
+
+func codeKey(code string) string   { return "url:code:" + code }
+func aliasKey(alias string) string { return "url:alias:" + alias }
+func idKey(id uint) string         { return "url:id:" + strconv.FormatUint(uint64(id), 10) }
@@ -0,0 +1,217 @@
+package repository_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.URL{}, &model.Click{}, &model.RedirectRule{}, &model.LinkVariant{}))
+	return db
+}
+
+// memCache is an in-memory cache.Cache and cache.PubSub shared by the replicas of a test; TTLs
+// are ignored and messages are delivered synchronously
+type memCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	subs map[string]map[int]func(string)
+	next int
+}
+
+func newMemCache() *memCache {
+	return &memCache{data: make(map[string][]byte), subs: make(map[string]map[int]func(string))}
+}
+
+func (c *memCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.data[key]
+	return v, ok, nil
+}
+
+func (c *memCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+	return nil
+}
+
+func (c *memCache) Delete(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		delete(c.data, k)
+	}
+	return nil
+}
+
+func (c *memCache) Publish(channel, message string) error {
+	c.mu.Lock()
+	var handlers []func(string)
+	for _, h := range c.subs[channel] {
+		handlers = append(handlers, h)
+	}
+	c.mu.Unlock()
+	for _, h := range handlers {
+		h(message)
+	}
+	return nil
+}
+
+func (c *memCache) Subscribe(ctx context.Context, channel string, handle func(message string)) error {
+	c.mu.Lock()
+	id := c.next
+	c.next++
+	if c.subs[channel] == nil {
+		c.subs[channel] = make(map[int]func(string))
+	}
+	c.subs[channel][id] = handle
+	c.mu.Unlock()
+	<-ctx.Done()
+	c.mu.Lock()
+	delete(c.subs[channel], id)
+	c.mu.Unlock()
+	return ctx.Err()
+}
+
+func (c *memCache) subscriberCount(channel string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.subs[channel])
+}
+
+// TestSharedInvalidationAcrossReplicas edits a link through one replica and expects the other
+// replica's local cache to drop its copy.
+func TestSharedInvalidationAcrossReplicas(t *testing.T) {
+	db := setupDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shared := newMemCache()
+	replica := func() *repository.CachedURLRepository {
+		base := repository.NewSharedURLRepository(repository.NewURLRepository(db), shared, shared, time.Minute, time.Minute)
+		local := repository.NewCachedURLRepository(base, 100, time.Minute, time.Minute)
+		go shared.Subscribe(ctx, repository.InvalidationChannel, func(msg string) {
+			id, _ := strconv.ParseUint(msg, 10, 64)
+			local.Invalidate(uint(id))
+		})
+		return local
+	}
+	a, b := replica(), replica()
+	require.Eventually(t, func() bool { return shared.subscriberCount(repository.InvalidationChannel) == 2 }, time.Second, 5*time.Millisecond)
+
+	svc := service.NewURLService(a, nil)
+	token, err := svc.ShortenForUser("https://replicas.com", 0)
+	require.NoError(t, err)
+
+	// Replica B warms its local cache
+	urlObj, err := b.FindByShortURL(token)
+	require.NoError(t, err)
+	assert.Equal(t, "https://replicas.com", urlObj.OriginalURL)
+
+	urlObj.OriginalURL = "https://replicas.com/v2"
+	require.NoError(t, a.Update(urlObj))
+
+	assert.Eventually(t, func() bool {
+		got, err := b.FindByShortURL(token)
+		return err == nil && got.OriginalURL == "https://replicas.com/v2"
+	}, time.Second, 5*time.Millisecond)
+}
+
+// TestSharedCacheKeepsHiddenColumns makes sure links read back from the shared cache still carry
+// fields that are left out of JSON responses
+func TestSharedCacheKeepsHiddenColumns(t *testing.T) {
+	db := setupDB(t)
+	shared := newMemCache()
+	repo := repository.NewSharedURLRepository(repository.NewURLRepository(db), shared, nil, time.Minute, time.Minute)
+
+	link := &model.URL{ShortenedURL: "locked", OriginalURL: "https://intranet.example", PasswordHash: "hash", HasRules: true, HasVariants: true}
+	require.NoError(t, repo.Save(link))
+	require.NoError(t, repository.NewRuleRepository(db).Save(&model.RedirectRule{URLID: link.ID, Position: 1, Destination: "https://intranet.example/de", Languages: []string{"de"}}))
+	require.NoError(t, repository.NewVariantRepository(db).Save(&model.LinkVariant{URLID: link.ID, Destination: "https://intranet.example/a", Weight: 1}))
+	for i := 0; i < 2; i++ { // load, then hit
+		got, err := repo.FindByShortURL("locked")
+		require.NoError(t, err)
+		assert.Equal(t, "hash", got.PasswordHash)
+		if assert.Len(t, got.Rules, 1) {
+			assert.Equal(t, []string{"de"}, got.Rules[0].Languages)
+		}
+		assert.Len(t, got.Variants, 1)
+	}
+}
+
+// TestSharedCacheRename renames a link whose new name was cached as unknown while checking it was free
+func TestSharedCacheRename(t *testing.T) {
+	db := setupDB(t)
+	shared := newMemCache()
+	repo := repository.NewSharedURLRepository(repository.NewURLRepository(db), shared, nil, time.Minute, time.Minute)
+
+	link := &model.URL{ShortenedURL: "oldname", CustomAlias: "oldname", OriginalURL: "https://rename.com"}
+	require.NoError(t, repo.Save(link))
+	_, err := repo.FindByShortURL("newname")
+	require.Error(t, err)
+
+	link.ShortenedURL, link.CustomAlias = "newname", "newname"
+	require.NoError(t, repo.Update(link))
+	got, err := repo.FindByShortURL("newname")
+	require.NoError(t, err)
+	assert.Equal(t, "https://rename.com", got.OriginalURL)
+}
+
+// editDuringLoad runs edit once, after the next lookup by code has read the database but before
+// its result is cached
+type editDuringLoad struct {
+	domain.URLRepository
+	edit func()
+}
+
+func (r *editDuringLoad) FindByShortURL(shortURL string) (*model.URL, error) {
+	url, err := r.URLRepository.FindByShortURL(shortURL)
+	if edit := r.edit; edit != nil {
+		r.edit = nil
+		edit()
+	}
+	return url, err
+}
+
+// TestSharedCacheDropsLoadsRacingEdits edits a link while another lookup is loading it; the lookup
+// must not leave its stale copy in the shared cache
+func TestSharedCacheDropsLoadsRacingEdits(t *testing.T) {
+	db := setupDB(t)
+	inner := &editDuringLoad{URLRepository: repository.NewURLRepository(db)}
+	repo := repository.NewSharedURLRepository(inner, newMemCache(), nil, time.Minute, time.Minute)
+
+	link := &model.URL{ShortenedURL: "racy", OriginalURL: "https://old.com"}
+	require.NoError(t, repo.Save(link))
+	inner.edit = func() {
+		edited := *link
+		edited.OriginalURL = "https://new.com"
+		require.NoError(t, repo.Update(&edited))
+	}
+	got, err := repo.FindByShortURL("racy")
+	require.NoError(t, err)
+	assert.Equal(t, "https://old.com", got.OriginalURL)
+
+	got, err = repo.FindByShortURL("racy")
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.com", got.OriginalURL)
+}
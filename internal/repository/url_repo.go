@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"errors"
 	"gorm.io/gorm"
+	"time"
 	"url-shortener/internal/domain"
 	"url-shortener/internal/model"
 )
@@ -10,38 +12,171 @@ type urlRepository struct {
 	db *gorm.DB
 }
 
+// dbError converts gorm errors into domain errors so callers never depend on the ORM
+func dbError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return domain.ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return domain.ErrConflict
+	}
+	return &domain.StorageError{Err: err}
+}
+
 func NewURLRepository(db *gorm.DB) domain.URLRepository {
 	return &urlRepository{db: db}
 }
 
 func (r *urlRepository) Save(url *model.URL) error {
-	return r.db.Create(url).Error
+	return dbError(r.db.Create(url).Error)
 }
 
-func (r *urlRepository) FindByShortURL(shortURL string) (*model.URL, error) {
+func (r *urlRepository) FindByID(id uint) (*model.URL, error) {
 	var url model.URL
-	if err := r.db.Where("shortened_url = ?", shortURL).First(&url).Error; err != nil {
-		return nil, err
+	if err := r.db.Unscoped().First(&url, id).Error; err != nil {
+		return nil, dbError(err)
 	}
 	return &url, nil
 }
 
+func (r *urlRepository) FindByShortURL(shortURL string) (*model.URL, error) {
+	var url model.URL
+	if err := r.db.Unscoped().Where("shortened_url = ?", shortURL).First(&url).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return r.withParts(&url)
+}
+
 func (r *urlRepository) GetURLsByUser(userID uint) ([]model.URL, error) {
 	var urls []model.URL
 	if err := r.db.Where("user_id = ?", userID).Find(&urls).Error; err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return urls, nil
 }
 
+// editableColumns are the columns Update writes
+var editableColumns = []string{
+	"shortened_url", "original_url", "custom_alias", "custom_alias_display", "activates_at", "coming_soon_url",
+	"expiration", "max_clicks", "fallback_url", "expired_page", "utm_source", "utm_medium", "utm_campaign",
+	"title", "force_preview", "redirect_type", "query_passthrough", "path_passthrough", "password_hash",
+}
+
 func (r *urlRepository) Update(url *model.URL) error {
-	return r.db.Save(url).Error
+	return dbError(r.db.Model(url).Select(editableColumns).Updates(url).Error)
+}
+
+// ConsumeClick checks the click limit and increments the counter in one conditional UPDATE,
+// so concurrent redirects can neither overshoot max_clicks nor lose increments
+func (r *urlRepository) ConsumeClick(id uint, at time.Time) (bool, error) {
+	res := r.db.Model(&model.URL{}).
+		Where("id = ? AND (max_clicks IS NULL OR click_count < max_clicks)", id).
+		Updates(map[string]interface{}{
+			"click_count":     gorm.Expr("click_count + 1"),
+			"last_clicked_at": at,
+		})
+	if res.Error != nil {
+		return false, dbError(res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// IncrementClicks applies one grouped counter update per link in a single transaction
+func (r *urlRepository) IncrementClicks(deltas map[uint]domain.ClickDelta) error {
+	return dbError(r.db.Transaction(func(tx *gorm.DB) error {
+		for id, d := range deltas {
+			err := tx.Model(&model.URL{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"click_count": gorm.Expr("click_count + ?", d.Count),
+				"last_clicked_at": gorm.Expr(
+					"CASE WHEN last_clicked_at IS NULL OR last_clicked_at < ? THEN ? ELSE last_clicked_at END",
+					d.LastClickedAt, d.LastClickedAt),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
 }
 
 func (r *urlRepository) FindByCustomAlias(alias string) (*model.URL, error) {
 	var url model.URL
-	if err := r.db.Where("custom_alias = ?", alias).First(&url).Error; err != nil {
-		return nil, err
+	if err := r.db.Unscoped().Where("custom_alias = ?", alias).First(&url).Error; err != nil {
+		return nil, dbError(err)
 	}
-	return &url, nil
+	return r.withParts(&url)
+}
+
+// withParts loads the rules and variants a redirect of url needs, in the order they are tried
+func (r *urlRepository) withParts(url *model.URL) (*model.URL, error) {
+	if url.HasRules {
+		if err := r.db.Where("url_id = ?", url.ID).Order("position, id").Find(&url.Rules).Error; err != nil {
+			return nil, dbError(err)
+		}
+	}
+	if url.HasVariants {
+		if err := r.db.Where("url_id = ?", url.ID).Order("id").Find(&url.Variants).Error; err != nil {
+			return nil, dbError(err)
+		}
+	}
+	return url, nil
+}
+
+func (r *urlRepository) SoftDelete(id uint) error {
+	return dbError(r.db.Delete(&model.URL{}, id).Error)
+}
+
+func (r *urlRepository) Restore(id uint) error {
+	return dbError(r.db.Unscoped().Model(&model.URL{}).Where("id = ?", id).Update("deleted_at", nil).Error)
+}
+
+func (r *urlRepository) Quarantine(id uint, reason string) error {
+	return dbError(r.db.Model(&model.URL{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"quarantined":       true,
+		"quarantine_reason": reason,
+	}).Error)
+}
+
+func (r *urlRepository) ClearQuarantine(id uint) error {
+	return dbError(r.db.Model(&model.URL{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"quarantined":       false,
+		"quarantine_reason": "",
+	}).Error)
+}
+
+func (r *urlRepository) SetHasRules(id uint, hasRules bool) error {
+	return dbError(r.db.Model(&model.URL{}).Where("id = ?", id).Update("has_rules", hasRules).Error)
+}
+
+func (r *urlRepository) SetHasVariants(id uint, hasVariants bool) error {
+	return dbError(r.db.Model(&model.URL{}).Where("id = ?", id).Update("has_variants", hasVariants).Error)
+}
+
+// PurgeDeleted hard-deletes links soft-deleted before cutoff together with their click history, rules and variants
+func (r *urlRepository) PurgeDeleted(cutoff time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&model.URL{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Where("url_id IN ?", ids).Delete(&model.Click{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("url_id IN ?", ids).Delete(&model.RedirectRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("url_id IN ?", ids).Delete(&model.LinkVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&model.URL{}, ids).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return ids, nil
 }
@@ -3,6 +3,7 @@ package repository
 import (
 	"errors"
 	"gorm.io/gorm"
+	"url-shortener/internal/domain"
 	"url-shortener/internal/model"
 )
 
@@ -19,15 +20,19 @@ func (r *UserRepository) CreateUser(user model.User) (model.User, error) {
 	err := r.db.Where("username = ?", user.Username).First(&existing).Error
 	if err == nil {
 		// user already exists
-		return model.User{}, errors.New("username already exists")
+		return model.User{}, domain.ErrUsernameTaken
 	}
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		// unexpected error
-		return model.User{}, err
+		return model.User{}, dbError(err)
 	}
 	// username not found, safe to create
 	if err := r.db.Create(&user).Error; err != nil {
-		return model.User{}, err
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// lost a race with a concurrent registration
+			return model.User{}, domain.ErrUsernameTaken
+		}
+		return model.User{}, dbError(err)
 	}
 	return user, nil
 }
@@ -36,10 +41,10 @@ func (r *UserRepository) GetUserByUsername(username string) (model.User, error)
 	var user model.User
 	err := r.db.Where("username = ?", username).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return model.User{}, errors.New("user not found")
+		return model.User{}, domain.ErrNotFound
 	}
 	if err != nil {
-		return model.User{}, err
+		return model.User{}, dbError(err)
 	}
 	return user, nil
 }
@@ -48,10 +53,32 @@ func (r *UserRepository) GetUserByID(id int) (model.User, error) {
 	var user model.User
 	err := r.db.First(&user, id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return model.User{}, errors.New("user not found")
+		return model.User{}, domain.ErrNotFound
 	}
 	if err != nil {
-		return model.User{}, err
+		return model.User{}, dbError(err)
 	}
 	return user, nil
 }
+
+func (r *UserRepository) LinkDefaults(userID uint) (domain.LinkDefaults, error) {
+	user, err := r.GetUserByID(int(userID))
+	if err != nil {
+		return domain.LinkDefaults{}, err
+	}
+	return domain.LinkDefaults{FallbackURL: user.FallbackURL, ExpiredPage: user.ExpiredPage}, nil
+}
+
+func (r *UserRepository) SetLinkDefaults(userID uint, defaults domain.LinkDefaults) error {
+	res := r.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"fallback_url": defaults.FallbackURL,
+		"expired_page": defaults.ExpiredPage,
+	})
+	if res.Error != nil {
+		return dbError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
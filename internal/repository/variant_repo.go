@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+type variantRepository struct {
+	db *gorm.DB
+}
+
+func NewVariantRepository(db *gorm.DB) domain.VariantRepository {
+	return &variantRepository{db: db}
+}
+
+func (r *variantRepository) FindByURLID(urlID uint) ([]model.LinkVariant, error) {
+	var variants []model.LinkVariant
+	if err := r.db.Where("url_id = ?", urlID).Order("id").Find(&variants).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return variants, nil
+}
+
+func (r *variantRepository) FindByID(id uint) (*model.LinkVariant, error) {
+	var variant model.LinkVariant
+	if err := r.db.First(&variant, id).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return &variant, nil
+}
+
+func (r *variantRepository) Save(variant *model.LinkVariant) error {
+	return dbError(r.db.Create(variant).Error)
+}
+
+func (r *variantRepository) Update(variant *model.LinkVariant) error {
+	return dbError(r.db.Save(variant).Error)
+}
+
+func (r *variantRepository) Delete(id uint) error {
+	return dbError(r.db.Delete(&model.LinkVariant{}, id).Error)
+}
@@ -0,0 +1,107 @@
+// Package reserved keeps the words that can't be used as custom aliases or generated codes:
+// names of the service's own routes, operator-supplied reserved words, and blocked words.
+package reserved
+
+import (
+	"bufio"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// List is safe for concurrent use; lookups ignore case
+type List struct {
+	mu       sync.RWMutex
+	reserved map[string]bool
+	blocked  map[string]bool
+}
+
+func New() *List {
+	return &List{reserved: make(map[string]bool), blocked: make(map[string]bool)}
+}
+
+// Reserve adds words that may not be used as an alias
+func (l *List) Reserve(words ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, w := range words {
+		if w = normalize(w); w != "" {
+			l.reserved[w] = true
+		}
+	}
+}
+
+// Block adds words that may not appear in an alias, on their own or as a dash/underscore separated part
+func (l *List) Block(words ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, w := range words {
+		if w = normalize(w); w != "" {
+			l.blocked[w] = true
+		}
+	}
+}
+
+// ReserveRoutes reserves the first static segment of every route registered on routes, so an
+// alias can neither shadow nor be shadowed by an endpoint.
+func (l *List) ReserveRoutes(routes chi.Routes) error {
+	return chi.Walk(routes, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment := strings.SplitN(strings.TrimPrefix(route, "/"), "/", 2)[0]
+		if segment != "" && !strings.ContainsAny(segment, "{*") {
+			l.Reserve(segment)
+		}
+		return nil
+	})
+}
+
+// IsReserved reports whether alias is a reserved word or contains a blocked one
+func (l *List) IsReserved(alias string) bool {
+	alias = normalize(alias)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.reserved[alias] || l.blocked[alias] {
+		return true
+	}
+	if len(l.blocked) == 0 {
+		return false
+	}
+	parts := strings.FieldsFunc(alias, func(r rune) bool { return r == '-' || r == '_' })
+	for _, p := range parts {
+		if l.blocked[p] {
+			return true
+		}
+	}
+	// catch separators used to sneak a word through, e.g. "b-a-d"
+	return l.blocked[strings.Join(parts, "")]
+}
+
+// LoadFile reads one word per line; blank lines and lines starting with # are skipped
+func LoadFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a word list in the LoadFile format
+func Parse(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+func normalize(word string) string {
+	return strings.ToLower(strings.TrimSpace(word))
+}
@@ -0,0 +1,48 @@
+package reserved_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/reserved"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveRoutes(t *testing.T) {
+	noop := func(http.ResponseWriter, *http.Request) {}
+	r := chi.NewRouter()
+	r.Get("/swagger/*", noop)
+	r.Post("/shorten", noop)
+	r.Get("/{shortURL}", noop)
+	r.Get("/stats/{shortURL}", noop)
+	r.Get("/user/urls", noop)
+	r.Patch("/urls/{id}", noop)
+
+	list := reserved.New()
+	require.NoError(t, list.ReserveRoutes(r))
+	for _, word := range []string{"swagger", "shorten", "stats", "user", "urls", "Stats"} {
+		assert.True(t, list.IsReserved(word), word)
+	}
+	assert.False(t, list.IsReserved("shortURL"))
+	assert.False(t, list.IsReserved("my-stats"))
+}
+
+func TestBlockedWords(t *testing.T) {
+	list := reserved.New()
+	list.Block("darn")
+	for _, alias := range []string{"darn", "DARN", "oh-darn", "darn_it", "d-a-r-n"} {
+		assert.True(t, list.IsReserved(alias), alias)
+	}
+	// blocked words only match whole parts, so innocent words containing them pass
+	assert.False(t, list.IsReserved("darnell"))
+}
+
+func TestParse(t *testing.T) {
+	words, err := reserved.Parse(strings.NewReader("# comment\nadmin\n\n  Help  \n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "Help"}, words)
+}
@@ -0,0 +1,116 @@
+package safety
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"url-shortener/internal/domain"
+)
+
+// HashPrefixList flags destinations whose SHA-256 hash starts with a listed prefix, following the
+// Safe Browsing scheme: each destination is expanded into host-suffix/path-prefix expressions,
+// e.g. "a.b.c/1/2.html?x" also checks "b.c/1/" and "a.b.c/", and every expression is hashed.
+// Lists ship prefixes of 4 to 32 bytes; short prefixes trade some false positives for size.
+type HashPrefixList struct {
+	prefixes map[int]map[string]bool // by prefix length in bytes
+}
+
+// NewHashPrefixList parses hex-encoded prefixes
+func NewHashPrefixList(prefixes []string) (*HashPrefixList, error) {
+	l := &HashPrefixList{prefixes: make(map[int]map[string]bool)}
+	for _, p := range prefixes {
+		b, err := hex.DecodeString(p)
+		if err != nil || len(b) < 4 || len(b) > sha256.Size {
+			return nil, fmt.Errorf("invalid hash prefix %q: want 8 to 64 hex digits", p)
+		}
+		if l.prefixes[len(b)] == nil {
+			l.prefixes[len(b)] = make(map[string]bool)
+		}
+		l.prefixes[len(b)][string(b)] = true
+	}
+	return l, nil
+}
+
+// LoadHashPrefixList reads one hex prefix per line; blank lines and # comments are skipped
+func LoadHashPrefixList(path string) (*HashPrefixList, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewHashPrefixList(lines)
+}
+
+func (l *HashPrefixList) Check(destination string) (domain.SafetyVerdict, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return domain.SafetyVerdict{}, nil
+	}
+	for _, expr := range Expressions(u) {
+		sum := sha256.Sum256([]byte(expr))
+		for n, set := range l.prefixes {
+			if set[string(sum[:n])] {
+				return domain.SafetyVerdict{Unsafe: true, Reason: "destination is on a malware or phishing list"}, nil
+			}
+		}
+	}
+	return domain.SafetyVerdict{}, nil
+}
+
+// Expressions lists the host-suffix/path-prefix combinations hashed for u: up to five hosts (the
+// exact host and suffixes built from its last five components) times up to six paths (the exact
+// path with and without query, then "/" and up to three leading directories).
+func Expressions(u *url.URL) []string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil
+	}
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		parts := strings.Split(host, ".")
+		if len(parts) > 5 {
+			parts = parts[len(parts)-5:]
+		}
+		for i := 0; i < len(parts)-1; i++ {
+			if suffix := strings.Join(parts[i:], "."); suffix != host {
+				hosts = append(hosts, suffix)
+			}
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	dir := "/"
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; ; i++ {
+		if dir != path {
+			paths = append(paths, dir)
+		}
+		// the last segment is the file name, not a directory
+		if i >= len(segments)-1 || i >= 3 {
+			break
+		}
+		dir += segments[i] + "/"
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expr := h + p; !seen[expr] {
+				seen[expr] = true
+				exprs = append(exprs, expr)
+			}
+		}
+	}
+	return exprs
+}
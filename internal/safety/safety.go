@@ -0,0 +1,121 @@
+// Package safety flags destinations that are known or likely to be malicious.
+package safety
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"url-shortener/internal/domain"
+)
+
+// Checkers runs several checkers in order and reports the first flag
+type Checkers []domain.URLSafetyChecker
+
+func (c Checkers) Check(destination string) (domain.SafetyVerdict, error) {
+	for _, checker := range c {
+		verdict, err := checker.Check(destination)
+		if err != nil || verdict.Unsafe {
+			return verdict, err
+		}
+	}
+	return domain.SafetyVerdict{}, nil
+}
+
+// DomainBlocklist flags destinations on a listed domain or any of its subdomains
+type DomainBlocklist struct {
+	domains map[string]bool
+}
+
+func NewDomainBlocklist(domains []string) *DomainBlocklist {
+	b := &DomainBlocklist{domains: make(map[string]bool, len(domains))}
+	for _, d := range domains {
+		if d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+			b.domains[d] = true
+		}
+	}
+	return b
+}
+
+// LoadDomainBlocklist reads one domain per line; blank lines and # comments are skipped
+func LoadDomainBlocklist(path string) (*DomainBlocklist, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewDomainBlocklist(lines), nil
+}
+
+func (b *DomainBlocklist) Check(destination string) (domain.SafetyVerdict, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return domain.SafetyVerdict{}, nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for host != "" {
+		if b.domains[host] {
+			return domain.SafetyVerdict{Unsafe: true, Reason: "domain " + host + " is blocklisted"}, nil
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return domain.SafetyVerdict{}, nil
+}
+
+// RegexDenylist flags destinations matching any of its patterns
+type RegexDenylist struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRegexDenylist compiles patterns, failing on the first invalid one
+func NewRegexDenylist(patterns []string) (*RegexDenylist, error) {
+	d := &RegexDenylist{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	return d, nil
+}
+
+// LoadRegexDenylist reads one pattern per line; blank lines and # comments are skipped
+func LoadRegexDenylist(path string) (*RegexDenylist, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegexDenylist(lines)
+}
+
+func (d *RegexDenylist) Check(destination string) (domain.SafetyVerdict, error) {
+	for _, re := range d.patterns {
+		if re.MatchString(destination) {
+			return domain.SafetyVerdict{Unsafe: true, Reason: "destination matches a denied pattern"}, nil
+		}
+	}
+	return domain.SafetyVerdict{}, nil
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
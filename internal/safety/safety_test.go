@@ -0,0 +1,85 @@
+package safety_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"testing"
+
+	"url-shortener/internal/safety"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainBlocklist(t *testing.T) {
+	list := safety.NewDomainBlocklist([]string{"evil.example", " Phish.Test. "})
+	for _, dest := range []string{"https://evil.example/login", "http://www.EVIL.example", "https://a.b.phish.test/"} {
+		v, err := list.Check(dest)
+		require.NoError(t, err)
+		assert.True(t, v.Unsafe, dest)
+		assert.NotEmpty(t, v.Reason)
+	}
+	for _, dest := range []string{"https://notevil.example", "https://example/evil.example"} {
+		v, err := list.Check(dest)
+		require.NoError(t, err)
+		assert.False(t, v.Unsafe, dest)
+	}
+}
+
+func TestRegexDenylist(t *testing.T) {
+	_, err := safety.NewRegexDenylist([]string{"("})
+	assert.Error(t, err)
+
+	list, err := safety.NewRegexDenylist([]string{`(?i)paypa1`, `\.exe$`})
+	require.NoError(t, err)
+	checker := safety.Checkers{safety.NewDomainBlocklist(nil), list}
+	v, err := checker.Check("https://PayPa1-secure.example/verify")
+	require.NoError(t, err)
+	assert.True(t, v.Unsafe)
+	v, err = checker.Check("https://downloads.example/setup.exe")
+	require.NoError(t, err)
+	assert.True(t, v.Unsafe)
+	v, err = checker.Check("https://paypal.com")
+	require.NoError(t, err)
+	assert.False(t, v.Unsafe)
+}
+
+func TestExpressions(t *testing.T) {
+	u, _ := url.Parse("http://a.b.c/1/2.html?param=1")
+	assert.ElementsMatch(t, []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}, safety.Expressions(u))
+
+	u, _ = url.Parse("http://a.b.c.d.e.f.g/1.html")
+	assert.ElementsMatch(t, []string{
+		"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+		"c.d.e.f.g/1.html", "c.d.e.f.g/",
+		"d.e.f.g/1.html", "d.e.f.g/",
+		"e.f.g/1.html", "e.f.g/",
+		"f.g/1.html", "f.g/",
+	}, safety.Expressions(u))
+
+	u, _ = url.Parse("http://1.2.3.4/1/")
+	assert.ElementsMatch(t, []string{"1.2.3.4/1/", "1.2.3.4/"}, safety.Expressions(u))
+}
+
+func TestHashPrefixList(t *testing.T) {
+	_, err := safety.NewHashPrefixList([]string{"abc"})
+	assert.Error(t, err)
+
+	full := sha256.Sum256([]byte("malware.example/"))
+	prefix := sha256.Sum256([]byte("phish.example/login/"))
+	list, err := safety.NewHashPrefixList([]string{hex.EncodeToString(full[:]), hex.EncodeToString(prefix[:4])})
+	require.NoError(t, err)
+
+	for _, dest := range []string{"http://www.malware.example/any/page", "https://phish.example/login/step2?id=1"} {
+		v, err := list.Check(dest)
+		require.NoError(t, err)
+		assert.True(t, v.Unsafe, dest)
+	}
+	v, err := list.Check("https://phish.example/about")
+	require.NoError(t, err)
+	assert.False(t, v.Unsafe)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// AliasFolding controls how custom aliases are normalized before they are stored or looked up,
+// so variants a reader can't tell apart resolve to one link.
+//
+// Folding applies when an alias is created or changed; aliases already stored are not rewritten.
+// After enabling it, older aliases keep resolving as typed, since alias links also use their alias
+// as short code, but not in other spellings, and a new alias that folds to the same key as an
+// older one is not rejected. Changing an older link's alias folds it.
+type AliasFolding int
+
+const (
+	// AliasFoldNone keeps aliases as typed
+	AliasFoldNone AliasFolding = iota
+	// AliasFoldCase lower-cases aliases
+	AliasFoldCase
+	// AliasFoldConfusables lower-cases aliases and maps 0 to o and 1 to l
+	AliasFoldConfusables
+)
+
+// ParseAliasFolding reads "none", "case" or "confusables"
+func ParseAliasFolding(name string) (AliasFolding, error) {
+	switch name {
+	case "", "none":
+		return AliasFoldNone, nil
+	case "case":
+		return AliasFoldCase, nil
+	case "confusables":
+		return AliasFoldConfusables, nil
+	}
+	return AliasFoldNone, fmt.Errorf("unknown alias folding %q", name)
+}
+
+var confusables = strings.NewReplacer("0", "o", "1", "l")
+
+// fold returns the key an alias is stored and looked up under
+func (f AliasFolding) fold(alias string) string {
+	switch f {
+	case AliasFoldCase:
+		return strings.ToLower(alias)
+	case AliasFoldConfusables:
+		return confusables.Replace(strings.ToLower(alias))
+	}
+	return alias
+}
+
+// WithAliasFolding normalizes custom aliases created or changed from now on; the casing given by
+// the owner is kept for display. See AliasFolding for links created before.
+func WithAliasFolding(f AliasFolding) URLServiceOption {
+	return func(s *urlService) {
+		s.folding = f
+	}
+}
+
+// findLink resolves a short code, falling back to the folded custom alias
+func (s *urlService) findLink(shortURL string) (*model.URL, error) {
+	urlObj, err := s.repo.FindByShortURL(shortURL)
+	if err == nil || !errors.Is(err, domain.ErrNotFound) {
+		return urlObj, err
+	}
+	return s.repo.FindByCustomAlias(s.folding.fold(shortURL))
+}
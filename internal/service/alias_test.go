@@ -0,0 +1,118 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/reserved"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservedAliases(t *testing.T) {
+	f := newFixture(t)
+	words := reserved.New()
+	words.Reserve("login", "stats")
+	svc := f.service(service.WithReservedWords(words), service.WithCodeGenerator(fixedCodes{}))
+
+	_, err := svc.ShortenWithOptions("https://example.com", 0, "Login", nil, nil, "", "", "")
+	assert.ErrorIs(t, err, domain.ErrAliasReserved)
+
+	_, err = svc.ShortenWithOptions("https://example.com", 1, "mine", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	urls, err := svc.GetURLsByUser(1)
+	assert.NoError(t, err)
+	alias := "stats"
+	_, err = svc.UpdateLink(urls[0].ID, 1, domain.LinkUpdate{CustomAlias: &alias})
+	assert.ErrorIs(t, err, domain.ErrAliasReserved)
+
+	// Generated codes skip reserved words too
+	words.Reserve("code0")
+	token, err := svc.Shorten("https://generated.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "code1", token)
+}
+
+func TestAliasFolding(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithAliasFolding(service.AliasFoldConfusables))
+
+	token, err := svc.ShortenWithOptions("https://sale.com", 7, "Summer-Sale-2010", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Summer-Sale-2010", token)
+
+	urlObj, err := f.repo.FindByCustomAlias("summer-sale-2olo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Summer-Sale-2010", urlObj.DisplayAlias())
+
+	// Variants differing only in case or confusable characters resolve to the same link...
+	for _, typed := range []string{"summer-sale-2010", "SUMMER-SALE-2O1O", "summer-sale-2olo"} {
+		dest, err := svc.Redirect(typed, domain.Visit{})
+		assert.NoError(t, err, typed)
+		assert.Equal(t, "https://sale.com", dest)
+	}
+	stats, err := svc.GetStats("SUMMER-sale-2010")
+	assert.NoError(t, err)
+	assert.Equal(t, urlObj.ID, stats.ID)
+
+	// ...and can't be registered again
+	_, err = svc.ShortenWithOptions("https://other.com", 8, "summer-sale-2O1O", nil, nil, "", "", "")
+	assert.ErrorIs(t, err, domain.ErrAliasTaken)
+
+	// Changing only the casing keeps the key and code
+	display := "SUMMER-SALE-2010"
+	updated, err := svc.UpdateLink(urlObj.ID, 7, domain.LinkUpdate{CustomAlias: &display})
+	assert.NoError(t, err)
+	assert.Equal(t, "summer-sale-2olo", updated.ShortenedURL)
+	assert.Equal(t, display, updated.DisplayAlias())
+}
+
+func TestAliasFoldingIsCreateTimeOnly(t *testing.T) {
+	f := newFixture(t)
+	before := f.service()
+	_, err := before.ShortenWithOptions("https://old.com", 7, "Old-Promo", nil, nil, "", "", "")
+	assert.NoError(t, err)
+
+	// Enabling folding later leaves the stored alias alone: it resolves as typed, not in other spellings
+	svc := f.service(service.WithAliasFolding(service.AliasFoldCase))
+	dest, err := svc.Redirect("Old-Promo", domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://old.com", dest)
+	_, err = svc.Redirect("old-promo", domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	// Changing the alias folds it
+	urlObj, err := f.repo.FindByCustomAlias("Old-Promo")
+	assert.NoError(t, err)
+	alias := "Old-Promo-2"
+	updated, err := svc.UpdateLink(urlObj.ID, 7, domain.LinkUpdate{CustomAlias: &alias})
+	assert.NoError(t, err)
+	assert.Equal(t, "old-promo-2", updated.CustomAlias)
+	dest, err = svc.Redirect("OLD-PROMO-2", domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://old.com", dest)
+}
+
+// brokenAliasLookups fails every lookup by alias like an unreachable database would
+type brokenAliasLookups struct {
+	domain.URLRepository
+}
+
+func (r brokenAliasLookups) FindByCustomAlias(alias string) (*model.URL, error) {
+	return nil, &domain.StorageError{Err: fmt.Errorf("connection refused")}
+}
+
+func TestAliasCheckReportsStorageErrors(t *testing.T) {
+	f := newFixture(t)
+	svc := service.NewURLService(brokenAliasLookups{f.repo}, f.clicks)
+
+	// An alias that can't be checked isn't taken for a free one
+	_, err := svc.ShortenWithOptions("https://down.com", 7, "launch", nil, nil, "", "", "")
+	var serr *domain.StorageError
+	assert.ErrorAs(t, err, &serr)
+	_, err = f.repo.FindByShortURL("launch")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/useragent"
+)
+
+// topReferrers limits the referrer breakdown to the most common domains
+const topReferrers = 10
+
+// topCities limits the city breakdown to the most common cities
+const topCities = 10
+
+// unknownLocation labels clicks GeoIP could not place or that were recorded without a database
+const unknownLocation = "(unknown)"
+
+// directTraffic labels clicks that arrived without a Referer header
+const directTraffic = "(direct)"
+
+func (s *urlService) GetBreakdowns(shortURL string) (*domain.Breakdowns, error) {
+	if s.clicks == nil {
+		return nil, fmt.Errorf("%w: click history not available", domain.ErrUnavailable)
+	}
+	urlObj, err := s.findLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	// Devices are never empty, so their counts add up to every recorded click
+	devices, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldDevice, 0)
+	if err != nil {
+		return nil, err
+	}
+	var total uint64
+	for _, d := range devices {
+		total += d.Count
+	}
+	referrers, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldReferrerDomain, topReferrers)
+	if err != nil {
+		return nil, err
+	}
+	labelEmpty(referrers, directTraffic)
+	browsers, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldBrowser, 0)
+	if err != nil {
+		return nil, err
+	}
+	systems, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldOS, 0)
+	if err != nil {
+		return nil, err
+	}
+	countries, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldCountry, 0)
+	if err != nil {
+		return nil, err
+	}
+	cities, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldCity, topCities)
+	if err != nil {
+		return nil, err
+	}
+	// Clicks recorded before parsing was added have no classification
+	labelEmpty(devices, useragent.DeviceUnknown)
+	labelEmpty(browsers, useragent.Other)
+	labelEmpty(systems, useragent.Other)
+	labelEmpty(countries, unknownLocation)
+	labelEmpty(cities, unknownLocation)
+	return &domain.Breakdowns{
+		Referrers: withPercent(referrers, total),
+		Devices:   withPercent(devices, total),
+		Browsers:  withPercent(browsers, total),
+		OS:        withPercent(systems, total),
+		Countries: withPercent(countries, total),
+		Cities:    withPercent(cities, total),
+	}, nil
+}
+
+func labelEmpty(counts []domain.ValueCount, label string) {
+	for i := range counts {
+		if counts[i].Value == "" {
+			counts[i].Value = label
+		}
+	}
+}
+
+func withPercent(counts []domain.ValueCount, total uint64) []domain.BreakdownEntry {
+	entries := make([]domain.BreakdownEntry, len(counts))
+	for i, c := range counts {
+		entries[i] = domain.BreakdownEntry{Value: c.Value, Count: c.Count}
+		if total > 0 {
+			entries[i].Percent = float64(c.Count) * 100 / float64(total)
+		}
+	}
+	return entries
+}
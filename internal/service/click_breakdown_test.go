@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBreakdowns(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	token, err := svc.ShortenForUser("https://breakdown.com", 0)
+	assert.NoError(t, err)
+
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	windows := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	visits := []domain.Visit{
+		{UserAgent: iphone, Referrer: "https://www.twitter.com/post/1"},
+		{UserAgent: iphone, Referrer: "https://twitter.com/post/2"},
+		{UserAgent: windows, Referrer: "https://news.ycombinator.com/"},
+		{UserAgent: windows},
+	}
+	for _, v := range visits {
+		_, err := svc.Redirect(token, v)
+		assert.NoError(t, err)
+	}
+
+	b, err := svc.GetBreakdowns(token)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BreakdownEntry{Value: "twitter.com", Count: 2, Percent: 50}, b.Referrers[0])
+	assert.Len(t, b.Referrers, 3)
+	assert.Contains(t, b.Referrers, domain.BreakdownEntry{Value: "(direct)", Count: 1, Percent: 25})
+	assert.ElementsMatch(t, []domain.BreakdownEntry{
+		{Value: "desktop", Count: 2, Percent: 50},
+		{Value: "mobile", Count: 2, Percent: 50},
+	}, b.Devices)
+	assert.ElementsMatch(t, []domain.BreakdownEntry{
+		{Value: "Chrome", Count: 2, Percent: 50},
+		{Value: "Safari", Count: 2, Percent: 50},
+	}, b.Browsers)
+	assert.ElementsMatch(t, []domain.BreakdownEntry{
+		{Value: "Windows", Count: 2, Percent: 50},
+		{Value: "iOS", Count: 2, Percent: 50},
+	}, b.OS)
+}
+
+type stubGeo map[string][2]string
+
+func (g stubGeo) Locate(ip string) (string, string, bool) {
+	loc, ok := g[ip]
+	return loc[0], loc[1], ok
+}
+
+func TestRedirectRecordsGeo(t *testing.T) {
+	f := newFixture(t)
+	geo := stubGeo{"203.0.113.7": {"MD", "Chisinau"}}
+	svc := f.service(service.WithGeoLocator(geo))
+
+	token, err := svc.ShortenForUser("https://geo.com", 0)
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{IP: "203.0.113.7"})
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{IP: "10.0.0.1"})
+	assert.NoError(t, err)
+
+	b, err := svc.GetBreakdowns(token)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []domain.BreakdownEntry{
+		{Value: "MD", Count: 1, Percent: 50},
+		{Value: "(unknown)", Count: 1, Percent: 50},
+	}, b.Countries)
+	assert.ElementsMatch(t, []domain.BreakdownEntry{
+		{Value: "Chisinau", Count: 1, Percent: 50},
+		{Value: "(unknown)", Count: 1, Percent: 50},
+	}, b.Cities)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// ClickRecorderConfig tunes click batching; zero values fall back to the defaults below
+type ClickRecorderConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+const (
+	defaultClickQueueSize     = 10000
+	defaultClickBatchSize     = 500
+	defaultClickFlushInterval = time.Second
+)
+
+// ClickRecorderStats reports clicks the recorder could not keep up with
+type ClickRecorderStats struct {
+	Queued        int    `json:"queued"`
+	Dropped       uint64 `json:"dropped"`
+	FailedFlushes uint64 `json:"failed_flushes"`
+}
+
+// ClickRecorder moves click bookkeeping off the redirect path. Clicks are queued in memory and
+// flushed in batches: one grouped counter update per link plus a bulk insert into the click log.
+// A failed flush is retried with the next one; clicks are only dropped, and counted, when the
+// queue or the retry buffer is full.
+type ClickRecorder struct {
+	repo      domain.URLRepository
+	clicks    domain.ClickRepository
+	queue     chan model.Click
+	batchSize int
+	interval  time.Duration
+
+	// owned by run: writes that failed and are retried on the next flush
+	pendingDeltas map[uint]domain.ClickDelta
+	pendingClicks []model.Click
+
+	dropped       atomic.Uint64
+	failedFlushes atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func NewClickRecorder(repo domain.URLRepository, clicks domain.ClickRepository, cfg ClickRecorderConfig) *ClickRecorder {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultClickQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultClickBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultClickFlushInterval
+	}
+	r := &ClickRecorder{
+		repo:      repo,
+		clicks:    clicks,
+		queue:     make(chan model.Click, cfg.QueueSize),
+		batchSize: cfg.BatchSize,
+		interval:  cfg.FlushInterval,
+		done:      make(chan struct{}),
+
+		pendingDeltas: make(map[uint]domain.ClickDelta),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues a click. A full queue means the database is falling behind, so the click is
+// dropped rather than adding a write to the redirect. Once closed, clicks are written synchronously.
+func (r *ClickRecorder) Record(click model.Click) {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		r.write(click)
+		return
+	}
+	select {
+	case r.queue <- click:
+	default:
+		r.dropped.Add(1)
+	}
+	r.mu.RUnlock()
+}
+
+// Stats returns the queue length and loss counters since startup
+func (r *ClickRecorder) Stats() ClickRecorderStats {
+	return ClickRecorderStats{
+		Queued:        len(r.queue),
+		Dropped:       r.dropped.Load(),
+		FailedFlushes: r.failedFlushes.Load(),
+	}
+}
+
+// Close stops accepting new clicks and waits until everything queued has been flushed
+func (r *ClickRecorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *ClickRecorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	batch := make([]model.Click, 0, r.batchSize)
+	for {
+		select {
+		case click, ok := <-r.queue:
+			if !ok {
+				r.flush(batch)
+				if lost := r.pendingCount(); lost > 0 {
+					r.dropped.Add(lost)
+					log.Printf("dropped %d clicks that could not be flushed before shutdown", lost)
+				}
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes batch together with whatever the previous flushes failed to write
+func (r *ClickRecorder) flush(batch []model.Click) {
+	for _, click := range batch {
+		addDelta(r.pendingDeltas, click)
+	}
+	if r.clicks != nil {
+		r.pendingClicks = append(r.pendingClicks, batch...)
+	}
+
+	if len(r.pendingDeltas) > 0 {
+		if err := r.repo.IncrementClicks(r.pendingDeltas); err != nil {
+			r.failedFlushes.Add(1)
+			log.Printf("failed to flush click counters for %d links, will retry: %v", len(r.pendingDeltas), err)
+		} else {
+			clear(r.pendingDeltas)
+		}
+	}
+	if len(r.pendingClicks) == 0 {
+		return
+	}
+	if err := r.clicks.SaveBatch(r.pendingClicks); err != nil {
+		r.failedFlushes.Add(1)
+		log.Printf("failed to flush %d clicks, will retry: %v", len(r.pendingClicks), err)
+		// Keep the newest clicks so an outage can't grow the buffer without bound
+		if excess := len(r.pendingClicks) - cap(r.queue); excess > 0 {
+			r.dropped.Add(uint64(excess))
+			r.pendingClicks = append(r.pendingClicks[:0], r.pendingClicks[excess:]...)
+		}
+		return
+	}
+	r.pendingClicks = r.pendingClicks[:0]
+}
+
+// pendingCount is the number of clicks still waiting to be written
+func (r *ClickRecorder) pendingCount() uint64 {
+	var n uint64
+	for _, d := range r.pendingDeltas {
+		n += d.Count
+	}
+	if m := uint64(len(r.pendingClicks)); m > n {
+		n = m
+	}
+	return n
+}
+
+// write records a single click straight away, for clicks that arrive after Close
+func (r *ClickRecorder) write(click model.Click) {
+	deltas := make(map[uint]domain.ClickDelta)
+	addDelta(deltas, click)
+	if err := r.repo.IncrementClicks(deltas); err != nil {
+		r.dropped.Add(1)
+		log.Printf("failed to record click for url %d: %v", click.URLID, err)
+		return
+	}
+	if r.clicks == nil {
+		return
+	}
+	if err := r.clicks.Save(&click); err != nil {
+		log.Printf("failed to log click for url %d: %v", click.URLID, err)
+	}
+}
+
+func addDelta(deltas map[uint]domain.ClickDelta, click model.Click) {
+	d := deltas[click.URLID]
+	d.Count++
+	if click.ClickedAt.After(d.LastClickedAt) {
+		d.LastClickedAt = click.ClickedAt
+	}
+	deltas[click.URLID] = d
+}
@@ -0,0 +1,135 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClickRecorderBatchesAndDrains(t *testing.T) {
+	f := newFixture(t)
+	recorder := service.NewClickRecorder(f.repo, f.clicks, service.ClickRecorderConfig{
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+	})
+	svc := f.service(service.WithClickRecorder(recorder))
+
+	a, err := svc.ShortenForUser("https://batch.com/a", 0)
+	assert.NoError(t, err)
+	b, err := svc.ShortenForUser("https://batch.com/b", 0)
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = svc.Redirect(a, domain.Visit{})
+		assert.NoError(t, err)
+	}
+	_, err = svc.Redirect(b, domain.Visit{})
+	assert.NoError(t, err)
+
+	// Pending clicks are written on shutdown
+	assert.NoError(t, recorder.Close(context.Background()))
+
+	statsA, err := svc.GetStats(a)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), statsA.ClickCount)
+	assert.NotNil(t, statsA.LastClickedAt)
+	statsB, err := svc.GetStats(b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), statsB.ClickCount)
+
+	history, err := f.clicks.FindByURLID(statsA.ID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 4)
+
+	// Clicks after Close are written synchronously
+	_, err = svc.Redirect(b, domain.Visit{})
+	assert.NoError(t, err)
+	statsB, err = svc.GetStats(b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), statsB.ClickCount)
+}
+
+// flakyCounters fails the first few counter updates, then blocks each one until release is closed
+type flakyCounters struct {
+	domain.URLRepository
+	mu       sync.Mutex
+	failures int
+	release  chan struct{}
+}
+
+func (r *flakyCounters) IncrementClicks(deltas map[uint]domain.ClickDelta) error {
+	r.mu.Lock()
+	if r.failures > 0 {
+		r.failures--
+		r.mu.Unlock()
+		return fmt.Errorf("database unavailable")
+	}
+	r.mu.Unlock()
+	if r.release != nil {
+		<-r.release
+	}
+	return r.URLRepository.IncrementClicks(deltas)
+}
+
+func TestClickRecorderRetriesFailedFlushes(t *testing.T) {
+	f := newFixture(t)
+	flaky := &flakyCounters{URLRepository: f.repo, failures: 1}
+	recorder := service.NewClickRecorder(flaky, f.clicks, service.ClickRecorderConfig{
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	svc := f.service()
+
+	token, err := svc.ShortenForUser("https://retry.com", 0)
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// The first batch fails and is written again with the final flush
+	for i := 0; i < 2; i++ {
+		recorder.Record(model.Click{URLID: urlObj.ID, ClickedAt: time.Now()})
+	}
+	assert.NoError(t, recorder.Close(context.Background()))
+
+	stats, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), stats.ClickCount)
+	assert.Equal(t, uint64(1), recorder.Stats().FailedFlushes)
+	assert.Zero(t, recorder.Stats().Dropped)
+}
+
+func TestClickRecorderDropsWhenFull(t *testing.T) {
+	f := newFixture(t)
+	flaky := &flakyCounters{URLRepository: f.repo, release: make(chan struct{})}
+	recorder := service.NewClickRecorder(flaky, f.clicks, service.ClickRecorderConfig{
+		QueueSize:     1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	})
+	svc := f.service()
+
+	token, err := svc.ShortenForUser("https://full.com", 0)
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// The first click is stuck in a slow flush, the second waits in the queue, the third doesn't fit
+	recorder.Record(model.Click{URLID: urlObj.ID, ClickedAt: time.Now()})
+	assert.Eventually(t, func() bool { return recorder.Stats().Queued == 0 }, time.Second, time.Millisecond)
+	recorder.Record(model.Click{URLID: urlObj.ID, ClickedAt: time.Now()})
+	recorder.Record(model.Click{URLID: urlObj.ID, ClickedAt: time.Now()})
+	assert.Equal(t, uint64(1), recorder.Stats().Dropped)
+
+	close(flaky.release)
+	assert.NoError(t, recorder.Close(context.Background()))
+	stats, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), stats.ClickCount)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"url-shortener/internal/domain"
+)
+
+// maxSeriesBuckets caps the size of a single time-series response
+const maxSeriesBuckets = 5000
+
+// seriesSlot is how finely the database groups clicks for a series. Every zone offset, and every
+// daylight-saving change, is a whole number of quarter hours, so a slot never straddles two buckets.
+const seriesSlot = 15 * time.Minute
+
+func (s *urlService) GetClickSeries(shortURL string, interval string, from, to time.Time, loc *time.Location) ([]domain.ClickBucket, error) {
+	if s.clicks == nil {
+		return nil, fmt.Errorf("%w: click history not available", domain.ErrUnavailable)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	if !to.After(from) {
+		return nil, &domain.ValidationError{Field: "from", Message: "from must be before to"}
+	}
+	if !isValidInterval(interval) {
+		return nil, &domain.ValidationError{Field: "interval", Message: "interval must be one of hour, day, week, month"}
+	}
+	urlObj, err := s.findLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build every bucket up front so empty periods are reported as zero
+	var buckets []domain.ClickBucket
+	index := make(map[int64]int)
+	for start := bucketStart(from.In(loc), interval); start.Before(to); start = nextBucket(start, interval) {
+		if len(buckets) == maxSeriesBuckets {
+			return nil, &domain.ValidationError{Field: "interval", Message: "too many buckets for the requested range"}
+		}
+		index[start.Unix()] = len(buckets)
+		buckets = append(buckets, domain.ClickBucket{Start: start})
+	}
+
+	slots, err := s.clicks.CountBetween(urlObj.ID, from.UTC(), to.UTC(), seriesSlot)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		start := bucketStart(slot.Start.In(loc), interval)
+		if i, ok := index[start.Unix()]; ok {
+			buckets[i].Count += slot.Count
+		}
+	}
+	return buckets, nil
+}
+
+func isValidInterval(interval string) bool {
+	switch interval {
+	case domain.IntervalHour, domain.IntervalDay, domain.IntervalWeek, domain.IntervalMonth:
+		return true
+	}
+	return false
+}
+
+// bucketStart truncates t to the beginning of its interval in t's location; weeks start on Monday
+func bucketStart(t time.Time, interval string) time.Time {
+	if interval == domain.IntervalHour {
+		// Truncate works on absolute time, which puts hours on :30 in zones like +05:30. Shifting by
+		// the offset in effect at t also keeps the two 1 a.m. hours apart when clocks go back.
+		_, offset := t.Zone()
+		shift := time.Duration(offset) * time.Second
+		return t.Add(shift).Truncate(time.Hour).Add(-shift)
+	}
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch interval {
+	case domain.IntervalWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	case domain.IntervalMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket steps by calendar units so daylight-saving changes don't shift bucket boundaries
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case domain.IntervalHour:
+		return start.Add(time.Hour)
+	case domain.IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case domain.IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
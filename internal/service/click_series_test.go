@@ -0,0 +1,73 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClickSeries(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	token, err := svc.ShortenForUser("https://series.com", 0)
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// 22:30 UTC on the 1st is already the 2nd in UTC+3
+	for _, ts := range []string{"2025-07-01T10:00:00Z", "2025-07-01T22:30:00Z", "2025-07-03T09:00:00Z"} {
+		at, _ := time.Parse(time.RFC3339, ts)
+		assert.NoError(t, f.clicks.Save(&model.Click{URLID: urlObj.ID, ClickedAt: at}))
+	}
+
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	from := time.Date(2025, 7, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2025, 7, 5, 0, 0, 0, 0, loc)
+	series, err := svc.GetClickSeries(token, domain.IntervalDay, from, to, loc)
+	assert.NoError(t, err)
+	assert.Len(t, series, 4)
+	counts := make([]uint64, len(series))
+	for i, b := range series {
+		counts[i] = b.Count
+		assert.True(t, b.Start.Equal(from.AddDate(0, 0, i)))
+	}
+	assert.Equal(t, []uint64{1, 1, 1, 0}, counts)
+
+	_, err = svc.GetClickSeries(token, "fortnight", from, to, loc)
+	assert.Error(t, err)
+}
+
+func TestGetClickSeriesHalfHourZone(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	token, err := svc.ShortenForUser("https://kolkata.com", 0)
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// 04:20 and 04:40 UTC are 09:50 and 10:10 in Kolkata, so they fall in different hours
+	for _, ts := range []string{"2025-07-01T04:20:00Z", "2025-07-01T04:40:00Z", "2025-07-01T04:50:00Z"} {
+		at, _ := time.Parse(time.RFC3339, ts)
+		assert.NoError(t, f.clicks.Save(&model.Click{URLID: urlObj.ID, ClickedAt: at}))
+	}
+
+	loc := time.FixedZone("IST", 5*60*60+30*60)
+	from := time.Date(2025, 7, 1, 9, 0, 0, 0, loc)
+	to := time.Date(2025, 7, 1, 12, 0, 0, 0, loc)
+	series, err := svc.GetClickSeries(token, domain.IntervalHour, from, to, loc)
+	assert.NoError(t, err)
+	assert.Len(t, series, 3)
+	counts := make([]uint64, len(series))
+	for i, b := range series {
+		counts[i] = b.Count
+		assert.True(t, b.Start.Equal(from.Add(time.Duration(i)*time.Hour)))
+		assert.Zero(t, b.Start.In(loc).Minute())
+	}
+	assert.Equal(t, []uint64{1, 2, 0}, counts)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// maxExpiredPageSize bounds custom expiry pages
+const maxExpiredPageSize = 64 << 10
+
+// WithLinkDefaults lets users set a fallback for all their links that don't have their own
+func WithLinkDefaults(defaults domain.LinkDefaultsRepository) URLServiceOption {
+	return func(s *urlService) {
+		s.defaults = defaults
+	}
+}
+
+// ended describes an expired or exhausted link, with the fallback its visitors get instead: the
+// link's own fallback URL or page, or else its owner's
+func (s *urlService) ended(urlObj *model.URL, err error) error {
+	ended := &domain.EndedError{Err: err, FallbackURL: urlObj.FallbackURL, Page: urlObj.ExpiredPage}
+	if ended.FallbackURL != "" || ended.Page != "" || urlObj.UserID == 0 || s.defaults == nil {
+		return ended
+	}
+	defaults, derr := s.defaults.LinkDefaults(urlObj.UserID)
+	if derr != nil {
+		log.Printf("failed to load link defaults of user %d: %v", urlObj.UserID, derr)
+		return ended
+	}
+	ended.FallbackURL, ended.Page = defaults.FallbackURL, defaults.ExpiredPage
+	return ended
+}
+
+// checkFallback normalizes and screens a fallback URL and checks the size of a custom expiry page
+func (s *urlService) checkFallback(fallbackURL, page string) (string, error) {
+	if len(page) > maxExpiredPageSize {
+		return "", &domain.ValidationError{Field: "expired_page", Message: fmt.Sprintf("expired_page must be at most %d bytes", maxExpiredPageSize)}
+	}
+	if fallbackURL == "" {
+		return "", nil
+	}
+	fallbackURL, err := s.normalizeAs("fallback_url", fallbackURL)
+	if err != nil {
+		return "", err
+	}
+	if err := s.screenDestination(fallbackURL); err != nil {
+		return "", err
+	}
+	return fallbackURL, nil
+}
+
+func (s *urlService) LinkDefaults(userID uint) (domain.LinkDefaults, error) {
+	if s.defaults == nil {
+		return domain.LinkDefaults{}, nil
+	}
+	return s.defaults.LinkDefaults(userID)
+}
+
+func (s *urlService) SetLinkDefaults(userID uint, defaults domain.LinkDefaults) (domain.LinkDefaults, error) {
+	if s.defaults == nil {
+		return domain.LinkDefaults{}, fmt.Errorf("link defaults are not stored: %w", domain.ErrUnavailable)
+	}
+	fallbackURL, err := s.checkFallback(defaults.FallbackURL, defaults.ExpiredPage)
+	if err != nil {
+		return domain.LinkDefaults{}, err
+	}
+	defaults.FallbackURL = fallbackURL
+	if err := s.defaults.SetLinkDefaults(userID, defaults); err != nil {
+		return domain.LinkDefaults{}, err
+	}
+	return defaults, nil
+}
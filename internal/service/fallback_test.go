@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/safety"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackForEndedLinks(t *testing.T) {
+	f := newFixture(t)
+	users := repository.NewUserRepository(f.db)
+	svc := f.service(service.WithLinkDefaults(users))
+	owner, err := users.CreateUser(model.User{Username: "promo"})
+	assert.NoError(t, err)
+	userID := uint(owner.ID)
+
+	one := uint64(1)
+	own, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com/may", UserID: userID, MaxClicks: &one, FallbackURL: "https://promo.com/june"})
+	assert.NoError(t, err)
+	plain, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com/april", UserID: userID, MaxClicks: &one})
+	assert.NoError(t, err)
+	for _, token := range []string{own, plain} {
+		_, err = svc.Redirect(token, domain.Visit{})
+		assert.NoError(t, err)
+	}
+
+	// The link's own fallback is used; the error still says why
+	_, err = svc.Redirect(own, domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrClickLimit)
+	var ended *domain.EndedError
+	if assert.ErrorAs(t, err, &ended) {
+		assert.Equal(t, "https://promo.com/june", ended.FallbackURL)
+	}
+
+	// Without one, the owner's default applies, and without that there is no fallback
+	_, err = svc.Redirect(plain, domain.Visit{})
+	if assert.ErrorAs(t, err, &ended) {
+		assert.Empty(t, ended.FallbackURL)
+		assert.Empty(t, ended.Page)
+	}
+	defaults, err := svc.SetLinkDefaults(userID, domain.LinkDefaults{ExpiredPage: "<h1>Offer ended</h1>"})
+	assert.NoError(t, err)
+	assert.Equal(t, "<h1>Offer ended</h1>", defaults.ExpiredPage)
+	_, err = svc.Redirect(plain, domain.Visit{})
+	if assert.ErrorAs(t, err, &ended) {
+		assert.Equal(t, "<h1>Offer ended</h1>", ended.Page)
+	}
+
+	_, err = svc.SetLinkDefaults(userID, domain.LinkDefaults{FallbackURL: "javascript:alert(1)"})
+	var verr *domain.ValidationError
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Equal(t, "fallback_url", verr.Field)
+	}
+	_, err = svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com", UserID: userID, ExpiredPage: strings.Repeat("x", 65<<10)})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestFallbackURLIsScreened(t *testing.T) {
+	f := newFixture(t)
+	users := repository.NewUserRepository(f.db)
+	svc := f.service(
+		service.WithLinkDefaults(users), service.WithSafetyChecker(safety.NewDomainBlocklist([]string{"evil.example"}), service.SafetyPolicy{}))
+	owner, err := users.CreateUser(model.User{Username: "screened"})
+	assert.NoError(t, err)
+
+	one := uint64(1)
+	_, err = svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com", MaxClicks: &one, FallbackURL: "https://evil.example"})
+	assert.ErrorIs(t, err, domain.ErrUnsafeURL)
+	_, err = svc.SetLinkDefaults(uint(owner.ID), domain.LinkDefaults{FallbackURL: "https://www.evil.example/promo"})
+	assert.ErrorIs(t, err, domain.ErrUnsafeURL)
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com", UserID: uint(owner.ID)})
+	assert.NoError(t, err)
+	urlObj, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	fallback := "https://evil.example"
+	_, err = svc.UpdateLink(urlObj.ID, uint(owner.ID), domain.LinkUpdate{FallbackURL: &fallback})
+	assert.ErrorIs(t, err, domain.ErrUnsafeURL)
+}
+
+func TestExpiredPageNeedsOwner(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	_, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com", ExpiredPage: "<h1>Log in again</h1>"})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	_, err = svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://promo.com", UserID: 5, ExpiredPage: "<h1>Sold out</h1>"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// DefaultDeletionRetention is how long soft-deleted links can be restored before they are purged
+const DefaultDeletionRetention = 30 * 24 * time.Hour
+
+// WithDeletionRetention overrides DefaultDeletionRetention
+func WithDeletionRetention(retention time.Duration) URLServiceOption {
+	return func(s *urlService) {
+		s.retention = retention
+	}
+}
+
+// ownedLink loads a link and checks that userID owns it
+func (s *urlService) ownedLink(id, userID uint) (*model.URL, error) {
+	urlObj, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if urlObj.UserID == 0 || urlObj.UserID != userID {
+		return nil, domain.ErrForbidden
+	}
+	return urlObj, nil
+}
+
+// DeleteLink soft-deletes a link; it stops redirecting but keeps its history until purged
+func (s *urlService) DeleteLink(id, userID uint) error {
+	urlObj, err := s.ownedLink(id, userID)
+	if err != nil {
+		return err
+	}
+	if urlObj.DeletedAt.Valid {
+		return nil
+	}
+	return s.repo.SoftDelete(urlObj.ID)
+}
+
+// RestoreLink undoes DeleteLink while the link is still within the retention window
+func (s *urlService) RestoreLink(id, userID uint) (*model.URL, error) {
+	urlObj, err := s.ownedLink(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !urlObj.DeletedAt.Valid {
+		return urlObj, nil
+	}
+	if time.Since(urlObj.DeletedAt.Time) > s.retention {
+		return nil, fmt.Errorf("%w: restore window has passed", domain.ErrDeleted)
+	}
+	if err := s.repo.Restore(urlObj.ID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(urlObj.ID)
+}
+
+// PurgeDeletedLinks hard-deletes links whose retention window has passed
+func (s *urlService) PurgeDeletedLinks() (int, error) {
+	ids, err := s.repo.PurgeDeleted(time.Now().Add(-s.retention))
+	return len(ids), err
+}
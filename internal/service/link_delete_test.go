@@ -0,0 +1,88 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteRestoreAndPurge(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithDeletionRetention(time.Hour))
+
+	owner := uint(3)
+	token, err := svc.ShortenWithOptions("https://delete.me", owner, "", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, svc.DeleteLink(urlObj.ID, owner+1), domain.ErrForbidden)
+	assert.NoError(t, svc.DeleteLink(urlObj.ID, owner))
+
+	// Deleted links stop redirecting and disappear from listings but keep their stats
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrDeleted)
+	urls, err := svc.GetURLsByUser(owner)
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+	stats, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stats.ClickCount)
+
+	restored, err := svc.RestoreLink(urlObj.ID, owner)
+	assert.NoError(t, err)
+	assert.False(t, restored.DeletedAt.Valid)
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+
+	// Past the retention window the link can't be restored and is purged with its clicks
+	assert.NoError(t, svc.DeleteLink(urlObj.ID, owner))
+	f.db.Model(&model.URL{}).Unscoped().Where("id = ?", urlObj.ID).Update("deleted_at", time.Now().Add(-2*time.Hour))
+	_, err = svc.RestoreLink(urlObj.ID, owner)
+	assert.ErrorIs(t, err, domain.ErrDeleted)
+
+	n, err := svc.PurgeDeletedLinks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = f.repo.FindByID(urlObj.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	history, err := f.clicks.FindByURLID(urlObj.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestPurgeRemovesLinkParts(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(
+		service.WithDeletionRetention(time.Hour), service.WithRedirectRules(repository.NewRuleRepository(f.db)),
+		service.WithVariants(repository.NewVariantRepository(f.db)))
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://app.com", UserID: 2})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	_, err = svc.AddRule(urlObj.ID, 2, model.RedirectRule{Destination: "https://app.com/de", Languages: []string{"de"}})
+	assert.NoError(t, err)
+	_, err = svc.AddVariant(urlObj.ID, 2, model.LinkVariant{Destination: "https://app.com/b", Weight: 50})
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.DeleteLink(urlObj.ID, 2))
+	f.db.Model(&model.URL{}).Unscoped().Where("id = ?", urlObj.ID).Update("deleted_at", time.Now().Add(-2*time.Hour))
+	n, err := svc.PurgeDeletedLinks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	var rules, variants int64
+	assert.NoError(t, f.db.Model(&model.RedirectRule{}).Where("url_id = ?", urlObj.ID).Count(&rules).Error)
+	assert.Zero(t, rules)
+	assert.NoError(t, f.db.Model(&model.LinkVariant{}).Where("url_id = ?", urlObj.ID).Count(&variants).Error)
+	assert.Zero(t, variants)
+}
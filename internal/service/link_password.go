@@ -0,0 +1,159 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// maxPasswordLength is the most bcrypt looks at
+const maxPasswordLength = 72
+
+// unlockAudience marks unlock tokens, so no other token signed with the same secret passes for one
+const unlockAudience = "link-unlock"
+
+// UnlockPolicy controls how password-protected links are unlocked
+type UnlockPolicy struct {
+	// TokenTTL is how long an unlocked link stays unlocked for the visitor
+	TokenTTL time.Duration
+	// MaxFailures wrong passwords per link and client are allowed within FailureWindow
+	MaxFailures   int
+	FailureWindow time.Duration
+	// Secret signs unlock tokens; without it links can't be unlocked
+	Secret []byte
+}
+
+// DefaultUnlockPolicy keeps links unlocked for an hour and allows 5 wrong passwords per 15 minutes.
+// It has no Secret, so it only suits deployments without password-protected links.
+var DefaultUnlockPolicy = UnlockPolicy{TokenTTL: time.Hour, MaxFailures: 5, FailureWindow: 15 * time.Minute}
+
+// WithUnlockPolicy replaces DefaultUnlockPolicy
+func WithUnlockPolicy(policy UnlockPolicy) URLServiceOption {
+	return func(s *urlService) {
+		s.unlock = policy
+	}
+}
+
+// hashLinkPassword hashes a new link password like UserService.Register does; empty removes the password
+func hashLinkPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordLength {
+		return "", &domain.ValidationError{Field: "password", Message: fmt.Sprintf("password must be at most %d bytes", maxPasswordLength)}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (s *urlService) Unlock(shortURL, password, clientIP string) (string, error) {
+	urlObj, err := s.resolve(shortURL)
+	if err != nil {
+		return "", err
+	}
+	if !urlObj.HasPassword() {
+		return "", &domain.ValidationError{Field: "password", Message: "link is not password protected"}
+	}
+	if len(s.unlock.Secret) == 0 {
+		return "", fmt.Errorf("%w: no secret for unlock tokens", domain.ErrUnavailable)
+	}
+	key := fmt.Sprintf("%d|%s", urlObj.ID, clientIP)
+	if !s.failures.allow(key, s.unlock) {
+		return "", domain.ErrTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(urlObj.PasswordHash), []byte(password)) != nil {
+		s.failures.fail(key, s.unlock)
+		return "", domain.ErrInvalidCredentials
+	}
+	s.failures.reset(key)
+	claims := jwt.MapClaims{
+		"aud":      unlockAudience,
+		"link_id":  float64(urlObj.ID),
+		"password": passwordFingerprint(urlObj),
+		"exp":      time.Now().Add(s.unlock.TokenTTL).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.unlock.Secret)
+}
+
+// checkPassword stops visitors who haven't unlocked a protected link. Tokens are bound to the
+// password they were issued for, so changing it locks everyone out again.
+func (s *urlService) checkPassword(urlObj *model.URL, visit domain.Visit) error {
+	if !urlObj.HasPassword() {
+		return nil
+	}
+	if len(s.unlock.Secret) == 0 {
+		return &domain.PasswordError{Link: urlObj}
+	}
+	token, err := jwt.Parse(visit.UnlockToken, func(t *jwt.Token) (interface{}, error) {
+		return s.unlock.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(),
+		jwt.WithAudience(unlockAudience))
+	if err == nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok &&
+			claims["link_id"] == float64(urlObj.ID) && claims["password"] == passwordFingerprint(urlObj) {
+			return nil
+		}
+	}
+	return &domain.PasswordError{Link: urlObj}
+}
+
+func passwordFingerprint(urlObj *model.URL) string {
+	sum := sha256.Sum256([]byte(urlObj.PasswordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// failureCounter counts recent wrong passwords per key
+type failureCounter struct {
+	mu      sync.Mutex
+	entries map[string]*failures
+}
+
+type failures struct {
+	count int
+	since time.Time
+}
+
+func (c *failureCounter) allow(key string, policy UnlockPolicy) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.entries[key]
+	return f == nil || time.Since(f.since) > policy.FailureWindow || f.count < policy.MaxFailures
+}
+
+func (c *failureCounter) fail(key string, policy UnlockPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*failures)
+	}
+	now := time.Now()
+	f := c.entries[key]
+	if f == nil || now.Sub(f.since) > policy.FailureWindow {
+		// Drop stale entries now and then so the map doesn't grow without bound
+		if len(c.entries) >= 10000 {
+			for k, e := range c.entries {
+				if now.Sub(e.since) > policy.FailureWindow {
+					delete(c.entries, k)
+				}
+			}
+		}
+		f = &failures{since: now}
+		c.entries[key] = f
+	}
+	f.count++
+}
+
+func (c *failureCounter) reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
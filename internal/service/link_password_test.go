@@ -0,0 +1,108 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var unlockSecret = []byte("test-unlock-secret-of-32-bytes!!")
+
+// signUnlockToken signs a token for urlObj's current password like Unlock does, with the given key
+// and audience, so a test can vary just those
+func signUnlockToken(t *testing.T, key []byte, audience string, urlObj *model.URL) string {
+	sum := sha256.Sum256([]byte(urlObj.PasswordHash))
+	claims := jwt.MapClaims{
+		"link_id":  float64(urlObj.ID),
+		"password": hex.EncodeToString(sum[:8]),
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestPasswordProtectedLinks(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(
+		service.WithUnlockPolicy(service.UnlockPolicy{TokenTTL: time.Hour, MaxFailures: 2, FailureWindow: time.Minute, Secret: unlockSecret}))
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://intranet.example/docs", UserID: 4, Password: "open sesame"})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "open sesame", urlObj.PasswordHash)
+
+	// Neither the redirect nor the preview gives the destination away
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrPasswordRequired)
+	_, err = svc.Preview(token, domain.Visit{UnlockToken: "forged"})
+	assert.ErrorIs(t, err, domain.ErrPasswordRequired)
+
+	// Tokens signed with another key, or meant for something else, don't unlock the link
+	for _, forged := range []string{
+		signUnlockToken(t, []byte("your_secret_key"), "link-unlock", urlObj),
+		signUnlockToken(t, unlockSecret, "", urlObj),
+		signUnlockToken(t, unlockSecret, "api", urlObj),
+	} {
+		_, err = svc.Redirect(token, domain.Visit{UnlockToken: forged})
+		assert.ErrorIs(t, err, domain.ErrPasswordRequired)
+	}
+	_, err = svc.Redirect(token, domain.Visit{UnlockToken: signUnlockToken(t, unlockSecret, "link-unlock", urlObj)})
+	assert.NoError(t, err)
+
+	_, err = svc.Unlock(token, "guess", "198.51.100.1")
+	assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	unlocked, err := svc.Unlock(token, "open sesame", "198.51.100.1")
+	assert.NoError(t, err)
+	dest, err := svc.Redirect(token, domain.Visit{UnlockToken: unlocked})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://intranet.example/docs", dest)
+
+	// Unlocked permanent redirects still must not be cached where other visitors could get them
+	permanent, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://intranet.example/hr", Password: "open sesame", RedirectType: domain.RedirectPermanent})
+	assert.NoError(t, err)
+	unlockedPermanent, err := svc.Unlock(permanent, "open sesame", "198.51.100.1")
+	assert.NoError(t, err)
+	target, err := svc.Follow(permanent, domain.Visit{UnlockToken: unlockedPermanent})
+	assert.NoError(t, err)
+	assert.Equal(t, domain.RedirectPermanent, target.Type)
+	assert.Zero(t, target.MaxAge)
+
+	// Wrong passwords are limited per client, even when the right one follows
+	for i := 0; i < 2; i++ {
+		_, err = svc.Unlock(token, "guess", "203.0.113.9")
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	}
+	_, err = svc.Unlock(token, "open sesame", "203.0.113.9")
+	assert.ErrorIs(t, err, domain.ErrTooManyAttempts)
+
+	// Changing the password invalidates tokens issued for the old one
+	newPassword := "changed"
+	_, err = svc.UpdateLink(urlObj.ID, 4, domain.LinkUpdate{Password: &newPassword})
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{UnlockToken: unlocked})
+	assert.ErrorIs(t, err, domain.ErrPasswordRequired)
+
+	// Without a secret nothing can be unlocked
+	unconfigured := f.service()
+	_, err = unconfigured.Unlock(token, "changed", "198.51.100.1")
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+
+	none := ""
+	_, err = svc.UpdateLink(urlObj.ID, 4, domain.LinkUpdate{Password: &none})
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// reservedQueryParams steer our own pages and are never handed on to destinations
+var reservedQueryParams = []string{"preview", "proceed"}
+
+// validateQueryPassthrough accepts the QueryPassthrough* policies, and empty to drop incoming params
+func validateQueryPassthrough(policy string) error {
+	switch policy {
+	case "", domain.QueryPassthroughKeep, domain.QueryPassthroughOverride, domain.QueryPassthroughAppend:
+		return nil
+	}
+	return &domain.ValidationError{Field: "query_passthrough", Message: "query_passthrough must be keep, override or append"}
+}
+
+// checkExtraPath rejects path segments after the code of links that don't pass them on, and
+// segments that would climb out of the destination's path
+func checkExtraPath(urlObj *model.URL, extraPath string) error {
+	if extraPath == "" {
+		return nil
+	}
+	if !urlObj.PathPassthrough {
+		return domain.ErrNotFound
+	}
+	for _, segment := range strings.Split(extraPath, "/") {
+		if segment == "." || segment == ".." {
+			return &domain.ValidationError{Field: "path", Message: "path must not contain . or .. segments"}
+		}
+	}
+	return nil
+}
+
+// passThrough hands the visitor's extra path and query params on to destination, as far as
+// urlObj allows. Destinations that don't parse are returned unchanged.
+func passThrough(destination string, urlObj *model.URL, visit domain.Visit) string {
+	passPath := urlObj.PathPassthrough && visit.ExtraPath != ""
+	passQuery := urlObj.QueryPassthrough != "" && visit.Query != ""
+	if !passPath && !passQuery {
+		return destination
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	if passPath {
+		u = u.JoinPath(visit.ExtraPath)
+	}
+	if passQuery {
+		// Malformed pairs are skipped; the rest still goes through
+		incoming, _ := url.ParseQuery(visit.Query)
+		for _, key := range reservedQueryParams {
+			incoming.Del(key)
+		}
+		u.RawQuery = mergeQuery(u.RawQuery, incoming, urlObj.QueryPassthrough)
+	}
+	return u.String()
+}
+
+// mergeQuery adds incoming params to a raw query string by policy. The destination's own params
+// keep their order and encoding; only those overridden are removed.
+func mergeQuery(rawQuery string, incoming url.Values, policy string) string {
+	switch policy {
+	case domain.QueryPassthroughKeep:
+		existing, _ := url.ParseQuery(rawQuery)
+		for key := range incoming {
+			if existing.Has(key) {
+				delete(incoming, key)
+			}
+		}
+	case domain.QueryPassthroughOverride:
+		var kept []string
+		for _, pair := range strings.Split(rawQuery, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if k, err := url.QueryUnescape(key); err == nil && incoming.Has(k) {
+				continue
+			}
+			if pair != "" {
+				kept = append(kept, pair)
+			}
+		}
+		rawQuery = strings.Join(kept, "&")
+	}
+	extra := incoming.Encode()
+	switch {
+	case extra == "":
+		return rawQuery
+	case rawQuery == "":
+		return extra
+	}
+	return rawQuery + "&" + extra
+}
@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"testing"
+
+	"url-shortener/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryAndPathPassthrough(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	_, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://docs.com", QueryPassthrough: "merge"})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+
+	tests := []struct {
+		name   string
+		opts   domain.ShortenOptions
+		visit  domain.Visit
+		dest   string
+		status error
+	}{
+		{"query dropped by default", domain.ShortenOptions{OriginalURL: "https://shop.com/?ref=a"},
+			domain.Visit{Query: "gclid=xyz"}, "https://shop.com/?ref=a", nil},
+		{"keep", domain.ShortenOptions{OriginalURL: "https://shop.com/?b=1&ref=a", QueryPassthrough: domain.QueryPassthroughKeep},
+			domain.Visit{Query: "ref=b&gclid=xyz"}, "https://shop.com/?b=1&ref=a&gclid=xyz", nil},
+		{"override", domain.ShortenOptions{OriginalURL: "https://shop.com/?b=1&ref=a", QueryPassthrough: domain.QueryPassthroughOverride},
+			domain.Visit{Query: "ref=b&gclid=xyz"}, "https://shop.com/?b=1&gclid=xyz&ref=b", nil},
+		{"append", domain.ShortenOptions{OriginalURL: "https://shop.com/?ref=a", QueryPassthrough: domain.QueryPassthroughAppend},
+			domain.Visit{Query: "ref=b"}, "https://shop.com/?ref=a&ref=b", nil},
+		{"our own params stay with us", domain.ShortenOptions{OriginalURL: "https://shop.com/", QueryPassthrough: domain.QueryPassthroughAppend},
+			domain.Visit{Query: "proceed=1&utm_term=x"}, "https://shop.com/?utm_term=x", nil},
+		{"path", domain.ShortenOptions{OriginalURL: "https://docs.com/v2/?lang=en#top", PathPassthrough: true},
+			domain.Visit{ExtraPath: "docs/intro"}, "https://docs.com/v2/docs/intro?lang=en#top", nil},
+		{"path and query", domain.ShortenOptions{OriginalURL: "https://docs.com/v2", PathPassthrough: true, QueryPassthrough: domain.QueryPassthroughKeep},
+			domain.Visit{ExtraPath: "a b/", Query: "q=1"}, "https://docs.com/v2/a%20b/?q=1", nil},
+		{"path without passthrough", domain.ShortenOptions{OriginalURL: "https://docs.com/v2"},
+			domain.Visit{ExtraPath: "docs"}, "", domain.ErrNotFound},
+		{"climbing out of the destination", domain.ShortenOptions{OriginalURL: "https://docs.com/v2", PathPassthrough: true},
+			domain.Visit{ExtraPath: "../admin"}, "", domain.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := svc.ShortenLink(tt.opts)
+			assert.NoError(t, err)
+			target, err := svc.Follow(token, tt.visit)
+			if tt.status != nil {
+				assert.ErrorIs(t, err, tt.status)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.dest, target.URL)
+			}
+		})
+	}
+
+	// Passthrough can be switched on later
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://docs.com", UserID: 7})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	on, policy := true, domain.QueryPassthroughOverride
+	_, err = svc.UpdateLink(urlObj.ID, 7, domain.LinkUpdate{PathPassthrough: &on, QueryPassthrough: &policy})
+	assert.NoError(t, err)
+	target, err := svc.Follow(token, domain.Visit{ExtraPath: "guide", Query: "gclid=1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://docs.com/guide?gclid=1", target.URL)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// DefaultPermanentRedirectMaxAge bounds how long clients cache 301 and 308 redirects, so a changed
+// destination still reaches visitors eventually
+const DefaultPermanentRedirectMaxAge = 24 * time.Hour
+
+// WithPermanentRedirectMaxAge changes how long clients may cache permanent redirects
+func WithPermanentRedirectMaxAge(maxAge time.Duration) URLServiceOption {
+	return func(s *urlService) {
+		s.permanentMaxAge = maxAge
+	}
+}
+
+// validateRedirectType accepts the Redirect* types, and empty for the default
+func validateRedirectType(redirectType string) error {
+	switch redirectType {
+	case "", domain.RedirectMovedPermanently, domain.RedirectFound, domain.RedirectTemporary,
+		domain.RedirectPermanent, domain.RedirectHTML:
+		return nil
+	}
+	return &domain.ValidationError{Field: "redirect_type", Message: "redirect_type must be one of 301, 302, 307, 308 or html"}
+}
+
+// redirectTarget tells where and how to send a visitor of urlObj. Permanent redirects are only
+// cacheable while every visit would end up at the same place: never for click-limited or
+// password-protected links or links with rules or variants, and no longer than the link lives.
+func (s *urlService) redirectTarget(urlObj *model.URL, visit domain.Visit, now time.Time) *domain.RedirectTarget {
+	target := &domain.RedirectTarget{URL: urlObj.OriginalURL, Type: urlObj.RedirectType}
+	if dest, ok := s.ruleDestination(urlObj, visit, now); ok {
+		target.URL = dest
+	} else if variant, visitorID := s.pickVariant(urlObj, visit); variant != nil {
+		target.URL, target.VariantID, target.VisitorID = variant.Destination, variant.ID, visitorID
+	}
+	target.URL = passThrough(target.URL, urlObj, visit)
+	if target.Type == "" {
+		target.Type = domain.DefaultRedirectType
+	}
+	permanent := target.Type == domain.RedirectMovedPermanently || target.Type == domain.RedirectPermanent
+	if !permanent || urlObj.MaxClicks != nil || urlObj.Quarantined || urlObj.HasPassword() ||
+		urlObj.HasRules || urlObj.HasVariants {
+		return target
+	}
+	target.MaxAge = s.permanentMaxAge
+	if urlObj.Expiration != nil {
+		if left := time.Until(*urlObj.Expiration); left < target.MaxAge {
+			target.MaxAge = left
+		}
+	}
+	if target.MaxAge < time.Second {
+		target.MaxAge = 0
+	}
+	return target
+}
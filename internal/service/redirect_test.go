@@ -0,0 +1,235 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectRecordsClick(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithIPHashKey([]byte("ip-key"), 0))
+
+	token, err := svc.ShortenForUser("https://clicks.com", 0)
+	assert.NoError(t, err)
+
+	visit := domain.Visit{
+		Referrer:       "https://news.example.org/post",
+		UserAgent:      "Mozilla/5.0",
+		IP:             "203.0.113.7",
+		AcceptLanguage: "en-US,en;q=0.9",
+	}
+	_, err = svc.Redirect(token, visit)
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	history, err := f.clicks.FindByURLID(urlObj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, visit.Referrer, history[0].Referrer)
+	assert.Equal(t, visit.UserAgent, history[0].UserAgent)
+	assert.Equal(t, visit.AcceptLanguage, history[0].AcceptLanguage)
+	assert.Len(t, history[0].IPHash, 64)
+	assert.NotContains(t, history[0].IPHash, visit.IP)
+	assert.Empty(t, history[1].IPHash)
+}
+
+func TestClickIPHashes(t *testing.T) {
+	f := newFixture(t)
+	visit := domain.Visit{IP: "203.0.113.7"}
+	ipHashes := func(name string, opts ...service.URLServiceOption) []string {
+		svc := f.service(opts...)
+		token, err := svc.ShortenForUser("https://hashes.com/"+name, 0)
+		assert.NoError(t, err)
+		for range 2 {
+			_, err = svc.Redirect(token, visit)
+			assert.NoError(t, err)
+		}
+		urlObj, err := f.repo.FindByShortURL(token)
+		assert.NoError(t, err)
+		history, err := f.clicks.FindByURLID(urlObj.ID)
+		assert.NoError(t, err)
+		hashes := make([]string, len(history))
+		for i, c := range history {
+			hashes[i] = c.IPHash
+		}
+		return hashes
+	}
+
+	// Hashes depend on the key, and stay comparable within a rotation period
+	a := ipHashes("a", service.WithIPHashKey([]byte("key-a"), 0))
+	b := ipHashes("b", service.WithIPHashKey([]byte("key-b"), 0))
+	assert.Equal(t, a[0], a[1])
+	assert.NotEqual(t, a[0], b[0])
+	daily := ipHashes("daily", service.WithIPHashKey([]byte("key-a"), 24*time.Hour))
+	assert.Equal(t, daily[0], daily[1])
+	assert.NotEqual(t, a[0], daily[0])
+
+	// Without a key the address isn't recorded at all
+	assert.Equal(t, []string{"", ""}, ipHashes("none"))
+}
+
+func TestClickLimitUnderConcurrency(t *testing.T) {
+	f := newFixture(t)
+	// a single connection keeps every goroutine on the same in-memory database
+	sqlDB, err := f.db.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	recorder := service.NewClickRecorder(f.repo, f.clicks, service.ClickRecorderConfig{})
+	defer recorder.Close(context.Background())
+	svc := f.service(service.WithClickRecorder(recorder))
+
+	for _, limit := range []uint64{1, 5} {
+		maxClicks := limit
+		token, err := svc.ShortenWithOptions("https://once.com/"+string(rune('a'+limit)), 0, "", nil, &maxClicks, "", "", "")
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for i := 0; i < 25; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := svc.Redirect(token, domain.Visit{}); err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int(limit), succeeded)
+		stats, err := svc.GetStats(token)
+		assert.NoError(t, err)
+		assert.Equal(t, limit, stats.ClickCount)
+		_, err = svc.Redirect(token, domain.Visit{})
+		assert.ErrorIs(t, err, domain.ErrClickLimit)
+	}
+}
+
+func TestRedirectErrorTaxonomy(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	_, err := svc.Redirect("nothing1", domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	past := time.Now().Add(-time.Minute)
+	assert.NoError(t, f.repo.Save(&model.URL{ShortenedURL: "expired1", OriginalURL: "https://old.com", Expiration: &past}))
+	_, err = svc.Redirect("expired1", domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrExpired)
+
+	_, err = svc.ShortenWithOptions("https://example.com", 0, "bad alias!", nil, nil, "", "", "")
+	var verr *domain.ValidationError
+	assert.ErrorAs(t, err, &verr)
+	assert.Equal(t, "custom_alias", verr.Field)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+
+	// A database outage is reported as unavailable, not as a missing link
+	sqlDB, err := f.db.DB()
+	assert.NoError(t, err)
+	assert.NoError(t, sqlDB.Close())
+	_, err = svc.Redirect("expired1", domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+	assert.NotErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestPreviewAndForcedPreview(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	_, err := svc.ShortenWithOptions("https://preview.com", 3, "peek", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByCustomAlias("peek")
+	assert.NoError(t, err)
+
+	// Previews don't count as clicks
+	link, err := svc.Preview("peek", domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://preview.com", link.OriginalURL)
+	assert.Equal(t, uint64(0), link.ClickCount)
+
+	title, force := "Our summer sale", true
+	_, err = svc.UpdateLink(urlObj.ID, 3, domain.LinkUpdate{Title: &title, ForcePreview: &force})
+	assert.NoError(t, err)
+	_, err = svc.Redirect("peek", domain.Visit{})
+	var perr *domain.PreviewError
+	if assert.ErrorAs(t, err, &perr) {
+		assert.Equal(t, title, perr.Link.Title)
+	}
+	dest, err := svc.Redirect("peek", domain.Visit{Proceed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://preview.com", dest)
+	stats, err := svc.GetStats("peek")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), stats.ClickCount)
+
+	long := strings.Repeat("x", 256)
+	_, err = svc.UpdateLink(urlObj.ID, 3, domain.LinkUpdate{Title: &long})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestRedirectTypes(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithPermanentRedirectMaxAge(time.Hour))
+
+	// Links redirect with 302 unless they ask otherwise
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://default.com"})
+	assert.NoError(t, err)
+	target, err := svc.Follow(token, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, domain.RedirectFound, target.Type)
+	assert.Zero(t, target.MaxAge)
+
+	token, err = svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://moved.com", UserID: 5, RedirectType: domain.RedirectPermanent})
+	assert.NoError(t, err)
+	target, err = svc.Follow(token, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://moved.com", target.URL)
+	assert.Equal(t, domain.RedirectPermanent, target.Type)
+	assert.Equal(t, time.Hour, target.MaxAge)
+
+	// Permanent redirects are cached no longer than the link lives, and never with a click limit
+	exp := time.Now().Add(10 * time.Minute)
+	limited := uint64(5)
+	expiring, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://soon.com", RedirectType: domain.RedirectMovedPermanently, Expiration: &exp})
+	assert.NoError(t, err)
+	target, err = svc.Follow(expiring, domain.Visit{})
+	assert.NoError(t, err)
+	assert.InDelta(t, 10*time.Minute, target.MaxAge, float64(time.Second))
+	capped, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://capped.com", RedirectType: domain.RedirectMovedPermanently, MaxClicks: &limited})
+	assert.NoError(t, err)
+	target, err = svc.Follow(capped, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Zero(t, target.MaxAge)
+
+	_, err = svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://bad.com", RedirectType: "303"})
+	var verr *domain.ValidationError
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Equal(t, "redirect_type", verr.Field)
+	}
+
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	html, empty := domain.RedirectHTML, ""
+	updated, err := svc.UpdateLink(urlObj.ID, 5, domain.LinkUpdate{RedirectType: &html})
+	assert.NoError(t, err)
+	assert.Equal(t, domain.RedirectHTML, updated.RedirectType)
+	updated, err = svc.UpdateLink(urlObj.ID, 5, domain.LinkUpdate{RedirectType: &empty})
+	assert.NoError(t, err)
+	assert.Empty(t, updated.RedirectType)
+}
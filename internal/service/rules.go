@@ -0,0 +1,402 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/useragent"
+)
+
+// maxRulesPerLink bounds the rules tried on every redirect of a link
+const maxRulesPerLink = 50
+
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// WithRedirectRules routes visitors by per-link rules; without it links only have OriginalURL
+func WithRedirectRules(rules domain.RuleRepository) URLServiceOption {
+	return func(s *urlService) {
+		s.rules = rules
+	}
+}
+
+func (s *urlService) ListRules(linkID, userID uint) ([]model.RedirectRule, error) {
+	urlObj, err := s.ruleLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.rules.FindByURLID(urlObj.ID)
+}
+
+func (s *urlService) AddRule(linkID, userID uint, rule model.RedirectRule) (*model.RedirectRule, error) {
+	urlObj, err := s.ruleLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateRule(&rule); err != nil {
+		return nil, err
+	}
+	existing, err := s.rules.FindByURLID(urlObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxRulesPerLink {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("a link can have at most %d rules", maxRulesPerLink)}
+	}
+	position := rule.Position
+	rule.ID, rule.URLID, rule.Position = 0, urlObj.ID, len(existing)+1
+	if err := s.rules.Save(&rule); err != nil {
+		return nil, err
+	}
+	if position > 0 && position < rule.Position {
+		if err := s.moveRule(existing, &rule, position); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.SetHasRules(urlObj.ID, true); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *urlService) UpdateRule(linkID, ruleID, userID uint, rule model.RedirectRule) (*model.RedirectRule, error) {
+	urlObj, err := s.ruleLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.ownedRule(urlObj, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateRule(&rule); err != nil {
+		return nil, err
+	}
+	position := rule.Position
+	rule.ID, rule.URLID, rule.Position, rule.CreatedAt = current.ID, current.URLID, current.Position, current.CreatedAt
+	if err := s.rules.Update(&rule); err != nil {
+		return nil, err
+	}
+	if position > 0 && position != current.Position {
+		existing, err := s.rules.FindByURLID(urlObj.ID)
+		if err != nil {
+			return nil, err
+		}
+		others := existing[:0]
+		for _, r := range existing {
+			if r.ID != rule.ID {
+				others = append(others, r)
+			}
+		}
+		if err := s.moveRule(others, &rule, position); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.SetHasRules(urlObj.ID, true); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *urlService) DeleteRule(linkID, ruleID, userID uint) error {
+	urlObj, err := s.ruleLink(linkID, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.ownedRule(urlObj, ruleID); err != nil {
+		return err
+	}
+	if err := s.rules.Delete(ruleID); err != nil {
+		return err
+	}
+	remaining, err := s.rules.FindByURLID(urlObj.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.rules.Reorder(urlObj.ID, ruleIDs(remaining)); err != nil {
+		return err
+	}
+	return s.repo.SetHasRules(urlObj.ID, len(remaining) > 0)
+}
+
+// ruleLink finds a link owned by userID whose rules can be managed
+func (s *urlService) ruleLink(linkID, userID uint) (*model.URL, error) {
+	if s.rules == nil {
+		return nil, fmt.Errorf("redirect rules are not stored: %w", domain.ErrUnavailable)
+	}
+	urlObj, err := s.ownedLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if urlObj.DeletedAt.Valid {
+		return nil, domain.ErrDeleted
+	}
+	return urlObj, nil
+}
+
+func (s *urlService) ownedRule(urlObj *model.URL, ruleID uint) (*model.RedirectRule, error) {
+	rule, err := s.rules.FindByID(ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule.URLID != urlObj.ID {
+		return nil, domain.ErrNotFound
+	}
+	return rule, nil
+}
+
+// moveRule puts rule at position (1-based) among the link's other rules and renumbers them all
+func (s *urlService) moveRule(others []model.RedirectRule, rule *model.RedirectRule, position int) error {
+	ids := ruleIDs(others)
+	i := min(position-1, len(ids))
+	ids = append(ids[:i], append([]uint{rule.ID}, ids[i:]...)...)
+	if err := s.rules.Reorder(rule.URLID, ids); err != nil {
+		return err
+	}
+	rule.Position = i + 1
+	return nil
+}
+
+func ruleIDs(rules []model.RedirectRule) []uint {
+	ids := make([]uint, len(rules))
+	for i, r := range rules {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// validateRule checks a rule and normalizes its destination and conditions
+func (s *urlService) validateRule(rule *model.RedirectRule) error {
+	dest, err := s.normalizeAs("destination", rule.Destination)
+	if err != nil {
+		return err
+	}
+	if err := s.screenDestination(dest); err != nil {
+		return err
+	}
+	rule.Destination = dest
+
+	for i, d := range rule.Devices {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch d {
+		case useragent.DeviceDesktop, useragent.DeviceMobile, useragent.DeviceTablet, useragent.DeviceBot:
+		default:
+			return &domain.ValidationError{Field: "devices", Message: "devices must be desktop, mobile, tablet or bot"}
+		}
+		rule.Devices[i] = d
+	}
+	for i, os := range rule.OS {
+		if rule.OS[i] = strings.TrimSpace(os); rule.OS[i] == "" {
+			return &domain.ValidationError{Field: "os", Message: "os must not contain empty names"}
+		}
+	}
+	for i, l := range rule.Languages {
+		l = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(l), "_", "-"))
+		if !languageTag.MatchString(l) {
+			return &domain.ValidationError{Field: "languages", Message: fmt.Sprintf("invalid language tag %q", rule.Languages[i])}
+		}
+		rule.Languages[i] = l
+	}
+	for i, c := range rule.Countries {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if len(c) != 2 || c[0] < 'A' || c[0] > 'Z' || c[1] < 'A' || c[1] > 'Z' {
+			return &domain.ValidationError{Field: "countries", Message: fmt.Sprintf("invalid country code %q", rule.Countries[i])}
+		}
+		rule.Countries[i] = c
+	}
+
+	if (rule.TimeFrom == "") != (rule.TimeTo == "") {
+		return &domain.ValidationError{Field: "time_to", Message: "time_from and time_to must be set together"}
+	}
+	if rule.TimeFrom != "" {
+		from, ferr := parseClock(rule.TimeFrom)
+		to, terr := parseClock(rule.TimeTo)
+		if ferr != nil || terr != nil || from == to {
+			return &domain.ValidationError{Field: "time_from", Message: "time_from and time_to must be different HH:MM times"}
+		}
+	} else if rule.TimeZone != "" {
+		return &domain.ValidationError{Field: "time_zone", Message: "time_zone needs time_from and time_to"}
+	}
+	if rule.TimeZone != "" {
+		if _, err := loadZone(rule.TimeZone); err != nil {
+			return &domain.ValidationError{Field: "time_zone", Message: "unknown time_zone " + rule.TimeZone}
+		}
+	}
+	if rule.StartsAt != nil && rule.EndsAt != nil && !rule.StartsAt.Before(*rule.EndsAt) {
+		return &domain.ValidationError{Field: "ends_at", Message: "ends_at must be after starts_at"}
+	}
+
+	if len(rule.Devices)+len(rule.OS)+len(rule.Languages)+len(rule.Countries) == 0 &&
+		rule.TimeFrom == "" && rule.StartsAt == nil && rule.EndsAt == nil {
+		return &domain.ValidationError{Message: "a rule needs at least one condition"}
+	}
+	if rule.Position < 0 {
+		return &domain.ValidationError{Field: "position", Message: "position must be >= 1"}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ruleDestination returns the destination of the first rule of urlObj the visitor matches; the
+// rules come with the link, see URLRepository.FindByShortURL
+func (s *urlService) ruleDestination(urlObj *model.URL, visit domain.Visit, now time.Time) (string, bool) {
+	if !urlObj.HasRules || s.rules == nil {
+		return "", false
+	}
+	v := &ruleVisitor{visit: visit, ua: useragent.Parse(visit.UserAgent), language: preferredLanguage(visit.AcceptLanguage), geo: s.geo}
+	for _, rule := range urlObj.Rules {
+		if v.matches(&rule, now) {
+			return rule.Destination, true
+		}
+	}
+	return "", false
+}
+
+// ruleVisitor holds what rules are matched against; the country is only looked up when a rule asks for it
+type ruleVisitor struct {
+	visit      domain.Visit
+	ua         useragent.Info
+	language   string
+	geo        domain.GeoLocator
+	country    string
+	geoChecked bool
+}
+
+func (v *ruleVisitor) matches(rule *model.RedirectRule, now time.Time) bool {
+	if rule.StartsAt != nil && now.Before(*rule.StartsAt) || rule.EndsAt != nil && !now.Before(*rule.EndsAt) {
+		return false
+	}
+	if rule.TimeFrom != "" && !inDailyWindow(rule, now) {
+		return false
+	}
+	if len(rule.Devices) > 0 && !containsFold(rule.Devices, v.ua.Device) {
+		return false
+	}
+	if len(rule.OS) > 0 && !containsFold(rule.OS, v.ua.OS) {
+		return false
+	}
+	if len(rule.Languages) > 0 && !matchesLanguage(rule.Languages, v.language) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !containsFold(rule.Countries, v.lookupCountry()) {
+		return false
+	}
+	return true
+}
+
+func (v *ruleVisitor) lookupCountry() string {
+	if !v.geoChecked {
+		v.geoChecked = true
+		if v.geo != nil && v.visit.IP != "" {
+			v.country, _, _ = v.geo.Locate(v.visit.IP)
+		}
+	}
+	return v.country
+}
+
+// inDailyWindow reports whether now falls in the rule's daily window; windows ending before they
+// start span midnight
+func inDailyWindow(rule *model.RedirectRule, now time.Time) bool {
+	from, ferr := parseClock(rule.TimeFrom)
+	to, terr := parseClock(rule.TimeTo)
+	if ferr != nil || terr != nil {
+		return false
+	}
+	if rule.TimeZone != "" {
+		loc, err := loadZone(rule.TimeZone)
+		if err != nil {
+			return false
+		}
+		now = now.In(loc)
+	} else {
+		now = now.UTC()
+	}
+	m := now.Hour()*60 + now.Minute()
+	if from < to {
+		return m >= from && m < to
+	}
+	return m >= from || m < to
+}
+
+// zones caches loaded time zones by name; time.LoadLocation reads the zone database every time.
+// Only names that passed validation are stored, so it stays as small as the zone database.
+var zones sync.Map
+
+func loadZone(name string) (*time.Location, error) {
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	zones.Store(name, loc)
+	return loc, nil
+}
+
+func containsFold(values []string, v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesLanguage matches a language tag against rule tags; "pt" also matches "pt-br"
+func matchesLanguage(tags []string, language string) bool {
+	if language == "" {
+		return false
+	}
+	for _, tag := range tags {
+		if language == tag || strings.HasPrefix(language, tag+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// preferredLanguage returns the lower-cased language the visitor ranks highest in an
+// Accept-Language header, or "" when there is none
+func preferredLanguage(header string) string {
+	type ranked struct {
+		tag string
+		q   float64
+	}
+	var langs []ranked
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if _, err := fmt.Sscanf(v, "%g", &q); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			langs = append(langs, ranked{tag, q})
+		}
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	return langs[0].tag
+}
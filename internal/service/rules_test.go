@@ -0,0 +1,191 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectRules(t *testing.T) {
+	f := newFixture(t)
+	geo := stubGeo{"203.0.113.7": {"MD", "Chisinau"}}
+	svc := f.service(service.WithGeoLocator(geo), service.WithRedirectRules(repository.NewRuleRepository(f.db)))
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://app.com", UserID: 7, RedirectType: domain.RedirectPermanent})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	ios, err := svc.AddRule(urlObj.ID, 7, model.RedirectRule{Destination: "https://apps.apple.com/app", OS: []string{"ios"}})
+	assert.NoError(t, err)
+	_, err = svc.AddRule(urlObj.ID, 7, model.RedirectRule{Destination: "https://play.google.com/app", OS: []string{"Android"}})
+	assert.NoError(t, err)
+	_, err = svc.AddRule(urlObj.ID, 7, model.RedirectRule{Destination: "https://app.com/de", Languages: []string{"de"}})
+	assert.NoError(t, err)
+	md, err := svc.AddRule(urlObj.ID, 7, model.RedirectRule{Destination: "https://app.com/md", Countries: []string{"md"}, Position: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, md.Position)
+	assert.Equal(t, []string{"MD"}, md.Countries)
+
+	rules, err := svc.ListRules(urlObj.ID, 7)
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 4) {
+		assert.Equal(t, md.ID, rules[0].ID)
+		assert.Equal(t, ios.ID, rules[1].ID)
+		assert.Equal(t, 2, rules[1].Position)
+	}
+
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	android := "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	tests := []struct {
+		visit domain.Visit
+		dest  string
+	}{
+		{domain.Visit{UserAgent: iphone}, "https://apps.apple.com/app"},
+		{domain.Visit{UserAgent: android}, "https://play.google.com/app"},
+		{domain.Visit{AcceptLanguage: "de-AT,de;q=0.9,en;q=0.5"}, "https://app.com/de"},
+		{domain.Visit{AcceptLanguage: "en-US,de;q=0.9"}, "https://app.com"},
+		// Rules are tried in order: the country rule comes first
+		{domain.Visit{UserAgent: iphone, IP: "203.0.113.7"}, "https://app.com/md"},
+		{domain.Visit{}, "https://app.com"},
+	}
+	for _, tt := range tests {
+		target, err := svc.Follow(token, tt.visit)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.dest, target.URL)
+		// Visitors may end up elsewhere next time, so even permanent redirects aren't cached
+		assert.Zero(t, target.MaxAge)
+	}
+
+	// Moving the iOS rule ahead of the country rule
+	ios.Position = 1
+	_, err = svc.UpdateRule(urlObj.ID, ios.ID, 7, *ios)
+	assert.NoError(t, err)
+	target, err := svc.Follow(token, domain.Visit{UserAgent: iphone, IP: "203.0.113.7"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://apps.apple.com/app", target.URL)
+
+	// Other users can't see or change the rules
+	_, err = svc.ListRules(urlObj.ID, 8)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	_, err = svc.AddRule(urlObj.ID, 7, model.RedirectRule{Destination: "https://app.com/x"})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	_, err = svc.AddRule(urlObj.ID, 7, model.RedirectRule{Destination: "https://app.com/x", TimeFrom: "09:00"})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+
+	rules, err = svc.ListRules(urlObj.ID, 7)
+	assert.NoError(t, err)
+	for _, rule := range rules {
+		assert.NoError(t, svc.DeleteRule(urlObj.ID, rule.ID, 7))
+	}
+	urlObj, err = f.repo.FindByID(urlObj.ID)
+	assert.NoError(t, err)
+	assert.False(t, urlObj.HasRules)
+	target, err = svc.Follow(token, domain.Visit{UserAgent: iphone})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://app.com", target.URL)
+}
+
+func TestTimedRedirectRules(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithRedirectRules(repository.NewRuleRepository(f.db)))
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://shop.com", UserID: 9})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// A window that always contains now, wrapping midnight, and one that never does
+	now := time.Now().UTC()
+	from, to := now.Add(-time.Minute).Format("15:04"), now.Add(-2*time.Minute).Format("15:04")
+	_, err = svc.AddRule(urlObj.ID, 9, model.RedirectRule{Destination: "https://shop.com/closed", TimeFrom: to, TimeTo: from})
+	assert.NoError(t, err)
+	ended := now.Add(-time.Hour)
+	_, err = svc.AddRule(urlObj.ID, 9, model.RedirectRule{Destination: "https://shop.com/old-sale", EndsAt: &ended})
+	assert.NoError(t, err)
+	_, err = svc.AddRule(urlObj.ID, 9, model.RedirectRule{Destination: "https://shop.com/open", TimeFrom: from, TimeTo: to, TimeZone: "UTC"})
+	assert.NoError(t, err)
+
+	dest, err := svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://shop.com/open", dest)
+}
+
+// countingRules counts rule lookups by link
+type countingRules struct {
+	domain.RuleRepository
+	lookups int
+}
+
+func (r *countingRules) FindByURLID(urlID uint) ([]model.RedirectRule, error) {
+	r.lookups++
+	return r.RuleRepository.FindByURLID(urlID)
+}
+
+// countingVariants counts variant lookups by link
+type countingVariants struct {
+	domain.VariantRepository
+	lookups int
+}
+
+func (r *countingVariants) FindByURLID(urlID uint) ([]model.LinkVariant, error) {
+	r.lookups++
+	return r.VariantRepository.FindByURLID(urlID)
+}
+
+func TestRulesAndVariantsAreCachedWithTheLink(t *testing.T) {
+	f := newFixture(t)
+	cached := repository.NewCachedURLRepository(f.repo, 100, time.Minute, time.Minute)
+	rules := &countingRules{RuleRepository: repository.NewRuleRepository(f.db)}
+	variants := &countingVariants{VariantRepository: repository.NewVariantRepository(f.db)}
+	svc := service.NewURLService(cached, f.clicks,
+		service.WithRedirectRules(rules), service.WithVariants(variants))
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://cached.com", UserID: 3})
+	assert.NoError(t, err)
+	urlObj, err := cached.FindByShortURL(token)
+	assert.NoError(t, err)
+	rule, err := svc.AddRule(urlObj.ID, 3, model.RedirectRule{Destination: "https://cached.com/de", Languages: []string{"de"}})
+	assert.NoError(t, err)
+	variant, err := svc.AddVariant(urlObj.ID, 3, model.LinkVariant{Destination: "https://cached.com/a", Weight: 1})
+	assert.NoError(t, err)
+
+	// Redirects read the rules and variants loaded with the link, not their repositories
+	rules.lookups, variants.lookups = 0, 0
+	for i := 0; i < 3; i++ {
+		dest, err := svc.Redirect(token, domain.Visit{AcceptLanguage: "de"})
+		assert.NoError(t, err)
+		assert.Equal(t, "https://cached.com/de", dest)
+		dest, err = svc.Redirect(token, domain.Visit{})
+		assert.NoError(t, err)
+		assert.Equal(t, "https://cached.com/a", dest)
+	}
+	assert.Zero(t, rules.lookups)
+	assert.Zero(t, variants.lookups)
+
+	// Changes show up right away even though the link is cached
+	rule.Destination = "https://cached.com/deutsch"
+	_, err = svc.UpdateRule(urlObj.ID, rule.ID, 3, *rule)
+	assert.NoError(t, err)
+	variant.Destination = "https://cached.com/b"
+	_, err = svc.UpdateVariant(urlObj.ID, variant.ID, 3, *variant)
+	assert.NoError(t, err)
+	dest, err := svc.Redirect(token, domain.Visit{AcceptLanguage: "de"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cached.com/deutsch", dest)
+	dest, err = svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cached.com/b", dest)
+
+	assert.NoError(t, svc.DeleteRule(urlObj.ID, rule.ID, 3))
+	assert.NoError(t, svc.DeleteVariant(urlObj.ID, variant.ID, 3))
+	dest, err = svc.Redirect(token, domain.Visit{AcceptLanguage: "de"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cached.com", dest)
+}
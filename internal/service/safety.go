@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// SafetyPolicy decides what happens to destinations a URLSafetyChecker flags
+type SafetyPolicy struct {
+	// Quarantine keeps flagged links behind an interstitial warning instead of refusing them
+	Quarantine bool
+	// CheckOnRedirect re-checks destinations when followed, catching ones listed after shortening
+	CheckOnRedirect bool
+}
+
+// WithSafetyChecker screens destinations when links are created or edited, and optionally when followed
+func WithSafetyChecker(checker domain.URLSafetyChecker, policy SafetyPolicy) URLServiceOption {
+	return func(s *urlService) {
+		s.safety = checker
+		s.safetyPolicy = policy
+	}
+}
+
+// screen checks a new destination for url. Flagged destinations are refused, or quarantined when
+// the policy says so; a clean destination lifts an earlier quarantine.
+func (s *urlService) screen(url *model.URL) error {
+	if s.safety == nil {
+		return nil
+	}
+	verdict, err := s.safety.Check(url.OriginalURL)
+	if err != nil {
+		return err
+	}
+	if !verdict.Unsafe {
+		url.Quarantined, url.QuarantineReason = false, ""
+		return nil
+	}
+	if !s.safetyPolicy.Quarantine {
+		return fmt.Errorf("%w: %s", domain.ErrUnsafeURL, verdict.Reason)
+	}
+	url.Quarantined, url.QuarantineReason = true, verdict.Reason
+	return nil
+}
+
+// screenDestination refuses flagged destinations that aren't the link's own, such as rule
+// destinations, regardless of the quarantine policy
+func (s *urlService) screenDestination(destination string) error {
+	if s.safety == nil {
+		return nil
+	}
+	verdict, err := s.safety.Check(destination)
+	if err != nil {
+		return err
+	}
+	if verdict.Unsafe {
+		return fmt.Errorf("%w: %s", domain.ErrUnsafeURL, verdict.Reason)
+	}
+	return nil
+}
+
+// checkQuarantine stops a redirect at the warning page unless the visitor already chose to proceed.
+// With CheckOnRedirect, destinations flagged since they were shortened are quarantined on the spot;
+// checker failures don't block redirects.
+func (s *urlService) checkQuarantine(urlObj *model.URL, visit domain.Visit) error {
+	if !urlObj.Quarantined && s.safety != nil && s.safetyPolicy.CheckOnRedirect {
+		verdict, err := s.safety.Check(urlObj.OriginalURL)
+		if err != nil {
+			log.Printf("safety check for url %d failed: %v", urlObj.ID, err)
+		} else if verdict.Unsafe {
+			urlObj.Quarantined, urlObj.QuarantineReason = true, verdict.Reason
+			if err := s.repo.Quarantine(urlObj.ID, verdict.Reason); err != nil {
+				log.Printf("failed to quarantine url %d: %v", urlObj.ID, err)
+			}
+		}
+	}
+	if urlObj.Quarantined && !visit.Proceed {
+		return &domain.QuarantineError{Destination: urlObj.OriginalURL, Reason: urlObj.QuarantineReason}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package service_test
+
+import (
+	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/safety"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafetyChecks(t *testing.T) {
+	blocklist := safety.NewDomainBlocklist([]string{"evil.example"})
+
+	// Refused by default
+	f := newFixture(t)
+	svc := f.service(service.WithSafetyChecker(blocklist, service.SafetyPolicy{}))
+	_, err := svc.ShortenForUser("https://login.evil.example/", 0)
+	assert.ErrorIs(t, err, domain.ErrUnsafeURL)
+
+	// Quarantined links redirect only once the visitor proceeds
+	svc = f.service(service.WithSafetyChecker(blocklist, service.SafetyPolicy{Quarantine: true}))
+	token, err := svc.ShortenForUser("https://login.evil.example/", 0)
+	assert.NoError(t, err)
+	_, err = svc.Redirect(token, domain.Visit{})
+	var qerr *domain.QuarantineError
+	assert.ErrorAs(t, err, &qerr)
+	assert.Equal(t, "https://login.evil.example/", qerr.Destination)
+	dest, err := svc.Redirect(token, domain.Visit{Proceed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://login.evil.example/", dest)
+
+	// Links listed after shortening are caught at redirect time
+	clean, err := svc.ShortenForUser("https://later.example/", 0)
+	assert.NoError(t, err)
+	_, err = svc.Redirect(clean, domain.Visit{})
+	assert.NoError(t, err)
+	blocklist = safety.NewDomainBlocklist([]string{"evil.example", "later.example"})
+	svc = f.service(service.WithSafetyChecker(blocklist, service.SafetyPolicy{Quarantine: true, CheckOnRedirect: true}))
+	_, err = svc.Redirect(clean, domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrQuarantined)
+	stored, err := f.repo.FindByShortURL(clean)
+	assert.NoError(t, err)
+	assert.True(t, stored.Quarantined)
+	assert.Equal(t, uint64(1), stored.ClickCount)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// WithComingSoonURL sends visitors of links that aren't active yet to url, unless the link has its
+// own coming soon URL; without one they get a coming soon page
+func WithComingSoonURL(url string) URLServiceOption {
+	return func(s *urlService) {
+		s.comingSoonURL = url
+	}
+}
+
+// validateSchedule checks that a link activates before it expires
+func validateSchedule(activatesAt, expiration *time.Time) error {
+	if activatesAt != nil && expiration != nil && !activatesAt.Before(*expiration) {
+		return &domain.ValidationError{Field: "activates_at", Message: "activates_at must be before expiration"}
+	}
+	return nil
+}
+
+// scheduled describes a link that isn't active yet
+func (s *urlService) scheduled(urlObj *model.URL) error {
+	err := &domain.ScheduledError{ActivatesAt: *urlObj.ActivatesAt, ComingSoonURL: urlObj.ComingSoonURL}
+	if err.ComingSoonURL == "" {
+		err.ComingSoonURL = s.comingSoonURL
+	}
+	return err
+}
+
+// checkComingSoonURL normalizes and screens a link's own coming soon URL
+func (s *urlService) checkComingSoonURL(raw string) (string, error) {
+	comingSoonURL, err := s.normalizeAs("coming_soon_url", raw)
+	if err != nil {
+		return "", err
+	}
+	if err := s.screenDestination(comingSoonURL); err != nil {
+		return "", err
+	}
+	return comingSoonURL, nil
+}
+
+// normalizeAs normalizes a destination given in another field than url, e.g. coming_soon_url
+func (s *urlService) normalizeAs(field, raw string) (string, error) {
+	normalized, err := s.dests.Normalize(raw)
+	var verr *domain.ValidationError
+	if errors.As(err, &verr) {
+		return "", &domain.ValidationError{Field: field, Reason: verr.Reason, Message: field + ": " + verr.Message}
+	}
+	return normalized, err
+}
@@ -0,0 +1,79 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/safety"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduledActivation(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithComingSoonURL("https://example.com/soon"))
+
+	launch := time.Now().Add(time.Hour)
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://launch.com", UserID: 6, ActivatesAt: &launch})
+	assert.NoError(t, err)
+	own, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://launch.com/b", UserID: 6, ActivatesAt: &launch, ComingSoonURL: "HTTPS://Teaser.com/b"})
+	assert.NoError(t, err)
+
+	// Before launch visitors are sent to the link's own or the default coming soon URL, and no click is counted
+	_, err = svc.Redirect(token, domain.Visit{})
+	var serr *domain.ScheduledError
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, "https://example.com/soon", serr.ComingSoonURL)
+		assert.WithinDuration(t, launch, serr.ActivatesAt, time.Second)
+	}
+	_, err = svc.Redirect(own, domain.Visit{})
+	if assert.ErrorAs(t, err, &serr) {
+		assert.Equal(t, "https://teaser.com/b", serr.ComingSoonURL)
+	}
+	stats, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), stats.ClickCount)
+	assert.Equal(t, model.LinkStateScheduled, stats.StateAt(time.Now()))
+
+	// Launch
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	past := time.Now().Add(-time.Minute)
+	_, err = svc.UpdateLink(urlObj.ID, 6, domain.LinkUpdate{ActivatesAt: &past})
+	assert.NoError(t, err)
+	dest, err := svc.Redirect(token, domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://launch.com", dest)
+
+	// A link can't activate after it expires
+	exp := time.Now().Add(time.Hour)
+	later := exp.Add(time.Hour)
+	_, err = svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://never.com", ActivatesAt: &later, Expiration: &exp})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	teaser := "ftp://teaser.com"
+	_, err = svc.UpdateLink(urlObj.ID, 6, domain.LinkUpdate{ComingSoonURL: &teaser})
+	var verr *domain.ValidationError
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Equal(t, "coming_soon_url", verr.Field)
+	}
+}
+
+func TestComingSoonURLIsScreened(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithSafetyChecker(safety.NewDomainBlocklist([]string{"evil.example"}), service.SafetyPolicy{}))
+
+	launch := time.Now().Add(time.Hour)
+	_, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://launch.com", ActivatesAt: &launch, ComingSoonURL: "https://evil.example/soon"})
+	assert.ErrorIs(t, err, domain.ErrUnsafeURL)
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://launch.com", UserID: 3, ActivatesAt: &launch})
+	assert.NoError(t, err)
+	urlObj, err := svc.GetStats(token)
+	assert.NoError(t, err)
+	teaser := "https://evil.example/soon"
+	_, err = svc.UpdateLink(urlObj.ID, 3, domain.LinkUpdate{ComingSoonURL: &teaser})
+	assert.ErrorIs(t, err, domain.ErrUnsafeURL)
+}
@@ -1,65 +1,220 @@
 package service
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
 	"net/url"
+	"strconv"
 	"time"
+	"url-shortener/internal/destination"
 	"url-shortener/internal/domain"
 	"url-shortener/internal/model"
+	"url-shortener/internal/shortcode"
+	"url-shortener/internal/useragent"
 )
 
 type urlService struct {
-	repo domain.URLRepository
+	repo            domain.URLRepository
+	clicks          domain.ClickRepository
+	geo             domain.GeoLocator
+	recorder        *ClickRecorder
+	retention       time.Duration
+	codes           domain.CodeGenerator
+	reserved        domain.ReservedWords
+	folding         AliasFolding
+	dests           domain.DestinationValidator
+	safety          domain.URLSafetyChecker
+	safetyPolicy    SafetyPolicy
+	permanentMaxAge time.Duration
+	unlock          UnlockPolicy
+	comingSoonURL   string
+	defaults        domain.LinkDefaultsRepository
+	rules           domain.RuleRepository
+	variants        domain.VariantRepository
+	failures        failureCounter
+	ipKey           []byte
+	ipKeyRotation   time.Duration
 }
 
-func NewURLService(repo domain.URLRepository) domain.URLService {
-	return &urlService{repo: repo}
+// maxTitleLength matches the title column size
+const maxTitleLength = 255
+
+// maxCodeAttempts bounds how many generated codes are tried before giving up on a link
+const maxCodeAttempts = 8
+
+var errNoFreeCode = fmt.Errorf("no free short code after %d attempts: %w", maxCodeAttempts, domain.ErrUnavailable)
+
+// URLServiceOption configures optional URL service features
+type URLServiceOption func(*urlService)
+
+// WithGeoLocator attributes recorded clicks to a country and city
+func WithGeoLocator(geo domain.GeoLocator) URLServiceOption {
+	return func(s *urlService) {
+		s.geo = geo
+	}
+}
+
+// WithIPHashKey keys the client address hashes kept in the click log and used to keep visitors
+// without a cookie on their variant. A positive rotation derives a new key for click hashes every
+// rotation period; visitor IDs keep using key, so visitors don't switch variants. Rotations
+// shorter than a second are treated as a second.
+func WithIPHashKey(key []byte, rotation time.Duration) URLServiceOption {
+	return func(s *urlService) {
+		s.ipKey = key
+		if rotation > 0 {
+			s.ipKeyRotation = max(rotation, time.Second)
+		}
+	}
+}
+
+// WithClickRecorder batches click updates in the background instead of writing them during the redirect
+func WithClickRecorder(recorder *ClickRecorder) URLServiceOption {
+	return func(s *urlService) {
+		s.recorder = recorder
+	}
+}
+
+// WithCodeGenerator replaces the default hash codes, e.g. with a shortcode.SequenceGenerator
+func WithCodeGenerator(codes domain.CodeGenerator) URLServiceOption {
+	return func(s *urlService) {
+		s.codes = codes
+	}
+}
+
+// WithReservedWords rejects aliases, and skips generated codes, that are reserved or blocked
+func WithReservedWords(words domain.ReservedWords) URLServiceOption {
+	return func(s *urlService) {
+		s.reserved = words
+	}
+}
+
+// WithDestinationValidator replaces the default destination checks, e.g. to reject links back to our own domain
+func WithDestinationValidator(dests domain.DestinationValidator) URLServiceOption {
+	return func(s *urlService) {
+		s.dests = dests
+	}
+}
+
+func NewURLService(repo domain.URLRepository, clicks domain.ClickRepository, opts ...URLServiceOption) domain.URLService {
+	s := &urlService{
+		repo:            repo,
+		clicks:          clicks,
+		retention:       DefaultDeletionRetention,
+		codes:           shortcode.NewHashGenerator(shortcode.Base62, shortcode.DefaultLength),
+		dests:           destination.New(destination.Config{}),
+		permanentMaxAge: DefaultPermanentRedirectMaxAge,
+		unlock:          DefaultUnlockPolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *urlService) Shorten(originalURL string) (string, error) {
-	shortURL := s.generateShortURL(originalURL)
+	originalURL, err := s.dests.Normalize(originalURL)
+	if err != nil {
+		return "", err
+	}
 	url := &model.URL{
-		OriginalURL:  originalURL,
-		ShortenedURL: shortURL,
-		CreatedAt:    time.Now(),
+		OriginalURL: originalURL,
+		CreatedAt:   time.Now(),
 	}
-	if err := s.repo.Save(url); err != nil {
+	if err := s.screen(url); err != nil {
 		return "", err
 	}
-	return shortURL, nil
+	if err := s.assignCode(url, true); err != nil {
+		return "", err
+	}
+	return url.ShortenedURL, nil
 }
 
-func (s *urlService) Redirect(shortURL string) (string, error) {
-	urlObj, err := s.repo.FindByShortURL(shortURL)
+func (s *urlService) Redirect(shortURL string, visit domain.Visit) (string, error) {
+	target, err := s.Follow(shortURL, visit)
 	if err != nil {
-		// also try custom alias
-		urlObj, err = s.repo.FindByCustomAlias(shortURL)
-		if err != nil {
-			return "", err
-		}
+		return "", err
+	}
+	return target.URL, nil
+}
+
+func (s *urlService) Follow(shortURL string, visit domain.Visit) (*domain.RedirectTarget, error) {
+	urlObj, err := s.resolve(shortURL)
+	if err != nil {
+		return nil, err
 	}
-	// Check expiration
-	if urlObj.Expiration != nil && time.Now().After(*urlObj.Expiration) {
-		return "", errors.New("link expired")
+	if err := checkExtraPath(urlObj, visit.ExtraPath); err != nil {
+		return nil, err
 	}
-	// Check click limit
-	if urlObj.MaxClicks != nil && urlObj.ClickCount >= *urlObj.MaxClicks {
-		return "", errors.New("click limit reached")
+	// The password comes first: the warning and preview pages show the destination
+	if err := s.checkPassword(urlObj, visit); err != nil {
+		return nil, err
+	}
+	if err := s.checkQuarantine(urlObj, visit); err != nil {
+		return nil, err
+	}
+	if urlObj.ForcePreview && !visit.Proceed {
+		return nil, &domain.PreviewError{Link: urlObj}
 	}
-	// update click statistics
-	urlObj.ClickCount++
 	now := time.Now()
-	urlObj.LastClickedAt = &now
-	err = s.repo.Update(urlObj)
+	target := s.redirectTarget(urlObj, visit, now)
+	click := s.newClick(urlObj.ID, now, visit)
+	click.VariantID = target.VariantID
+	// Links without a click limit don't need an up-to-date counter before redirecting
+	if s.recorder != nil && urlObj.MaxClicks == nil {
+		s.recorder.Record(click)
+		return target, nil
+	}
+	// update click statistics; the limit is re-checked atomically in case of concurrent redirects
+	consumed, err := s.repo.ConsumeClick(urlObj.ID, now)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return urlObj.OriginalURL, nil
+	if !consumed {
+		return nil, s.ended(urlObj, domain.ErrClickLimit)
+	}
+	s.saveClick(click)
+	return target, nil
+}
+
+func (s *urlService) Preview(shortURL string, visit domain.Visit) (*model.URL, error) {
+	urlObj, err := s.resolve(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPassword(urlObj, visit); err != nil {
+		return nil, err
+	}
+	return urlObj, nil
+}
+
+// resolve finds a link that can currently be followed
+func (s *urlService) resolve(shortURL string) (*model.URL, error) {
+	urlObj, err := s.findLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	switch urlObj.StateAt(time.Now()) {
+	case model.LinkStateDeleted:
+		return nil, domain.ErrDeleted
+	case model.LinkStateExpired:
+		return nil, s.ended(urlObj, domain.ErrExpired)
+	case model.LinkStateExhausted:
+		return nil, s.ended(urlObj, domain.ErrClickLimit)
+	case model.LinkStateScheduled:
+		return nil, s.scheduled(urlObj)
+	}
+	return urlObj, nil
 }
 
 func (s *urlService) ShortenForUser(originalURL string, userID uint) (string, error) {
+	originalURL, err := s.dests.Normalize(originalURL)
+	if err != nil {
+		return "", err
+	}
 	// First check if this URL already exists for this user
 	if userID > 0 {
 		existingURLs, err := s.repo.GetURLsByUser(userID)
@@ -72,85 +227,399 @@ func (s *urlService) ShortenForUser(originalURL string, userID uint) (string, er
 		}
 	}
 
-	shortURL := s.generateShortURL(originalURL)
-
-	// Check if this short URL already exists, if so, generate a new one
-	for {
-		existing, err := s.repo.FindByShortURL(shortURL)
-		if err != nil || existing == nil {
-			break // Short URL is unique, we can use it
-		}
-		// If existing URL is the same, return it
-		if existing.OriginalURL == originalURL {
-			return existing.ShortenedURL, nil
-		}
-		// Generate a new short URL with timestamp to ensure uniqueness
-		shortURL = s.generateShortURLWithTimestamp(originalURL)
-	}
-
 	url := &model.URL{
-		OriginalURL:  originalURL,
-		ShortenedURL: shortURL,
-		CreatedAt:    time.Now(),
-		UserID:       userID,
+		OriginalURL: originalURL,
+		CreatedAt:   time.Now(),
+		UserID:      userID,
 	}
-	if err := s.repo.Save(url); err != nil {
+	if err := s.screen(url); err != nil {
+		return "", err
+	}
+	if err := s.assignCode(url, true); err != nil {
 		return "", err
 	}
-	return shortURL, nil
+	return url.ShortenedURL, nil
 }
 
 func (s *urlService) ShortenWithOptions(originalURL string, userID uint, customAlias string, expiration *time.Time, maxClicks *uint64, utmSource, utmMedium, utmCampaign string) (string, error) {
-	// Validate custom alias
+	return s.ShortenLink(domain.ShortenOptions{
+		OriginalURL: originalURL,
+		UserID:      userID,
+		CustomAlias: customAlias,
+		Expiration:  expiration,
+		MaxClicks:   maxClicks,
+		UTMSource:   utmSource,
+		UTMMedium:   utmMedium,
+		UTMCampaign: utmCampaign,
+	})
+}
+
+func (s *urlService) ShortenLink(opts domain.ShortenOptions) (string, error) {
+	originalURL, err := s.dests.Normalize(opts.OriginalURL)
+	if err != nil {
+		return "", err
+	}
+	// Validate custom alias; the folded key doubles as the code
 	var shortURL string
-	if customAlias != "" {
-		// check format
-		if !isValidAlias(customAlias) {
-			return "", errors.New("invalid custom alias format")
-		}
-		// ensure uniqueness
-		if _, err := s.repo.FindByCustomAlias(customAlias); err == nil {
-			return "", errors.New("custom alias already in use")
+	if opts.CustomAlias != "" {
+		key, err := s.checkAlias(opts.CustomAlias, 0)
+		if err != nil {
+			return "", err
 		}
-		shortURL = customAlias
-	} else {
-		shortURL = s.generateShortURL(originalURL)
+		shortURL = key
 	}
-	// Append UTM params
-	parsed, err := url.Parse(originalURL)
+	if err := validateLimits(opts.Expiration, opts.MaxClicks); err != nil {
+		return "", err
+	}
+	if err := validateSchedule(opts.ActivatesAt, opts.Expiration); err != nil {
+		return "", err
+	}
+	// Custom pages are served from our own origin, so anonymous links can't have one
+	if opts.ExpiredPage != "" && opts.UserID == 0 {
+		return "", fmt.Errorf("%w: expired_page needs a signed-in user", domain.ErrUnauthorized)
+	}
+	fallbackURL, err := s.checkFallback(opts.FallbackURL, opts.ExpiredPage)
 	if err != nil {
 		return "", err
 	}
-	q := parsed.Query()
-	if utmSource != "" && q.Get("utm_source") == "" {
-		q.Set("utm_source", utmSource)
+	comingSoonURL := opts.ComingSoonURL
+	if comingSoonURL != "" {
+		if comingSoonURL, err = s.checkComingSoonURL(comingSoonURL); err != nil {
+			return "", err
+		}
 	}
-	if utmMedium != "" && q.Get("utm_medium") == "" {
-		q.Set("utm_medium", utmMedium)
+	if err := validateRedirectType(opts.RedirectType); err != nil {
+		return "", err
 	}
-	if utmCampaign != "" && q.Get("utm_campaign") == "" {
-		q.Set("utm_campaign", utmCampaign)
+	if err := validateQueryPassthrough(opts.QueryPassthrough); err != nil {
+		return "", err
+	}
+	passwordHash, err := hashLinkPassword(opts.Password)
+	if err != nil {
+		return "", err
+	}
+	// Append UTM params
+	finalURL, err := withUTM(originalURL, map[string]string{
+		"utm_source":   opts.UTMSource,
+		"utm_medium":   opts.UTMMedium,
+		"utm_campaign": opts.UTMCampaign,
+	}, false)
+	if err != nil {
+		return "", err
 	}
-	parsed.RawQuery = q.Encode()
-	finalURL := parsed.String()
 	// Prepare model
 	url := &model.URL{
-		OriginalURL:  finalURL,
-		ShortenedURL: shortURL,
-		CreatedAt:    time.Now(),
-		UserID:       userID,
-		CustomAlias:  customAlias,
-		Expiration:   expiration,
-		MaxClicks:    maxClicks,
-		UTMSource:    utmSource,
-		UTMMedium:    utmMedium,
-		UTMCampaign:  utmCampaign,
+		OriginalURL:      finalURL,
+		ShortenedURL:     shortURL,
+		CreatedAt:        time.Now(),
+		UserID:           opts.UserID,
+		CustomAlias:      shortURL,
+		ActivatesAt:      opts.ActivatesAt,
+		ComingSoonURL:    comingSoonURL,
+		Expiration:       opts.Expiration,
+		MaxClicks:        opts.MaxClicks,
+		FallbackURL:      fallbackURL,
+		ExpiredPage:      opts.ExpiredPage,
+		UTMSource:        opts.UTMSource,
+		UTMMedium:        opts.UTMMedium,
+		UTMCampaign:      opts.UTMCampaign,
+		RedirectType:     opts.RedirectType,
+		QueryPassthrough: opts.QueryPassthrough,
+		PathPassthrough:  opts.PathPassthrough,
+		PasswordHash:     passwordHash,
+	}
+	if opts.CustomAlias != "" {
+		url.CustomAliasDisplay = opts.CustomAlias
+	}
+	if err := s.screen(url); err != nil {
+		return "", err
 	}
 	// Save
+	if opts.CustomAlias == "" {
+		if err := s.assignCode(url, false); err != nil {
+			return "", err
+		}
+		return url.ShortenedURL, nil
+	}
 	if err := s.repo.Save(url); err != nil {
 		return "", err
 	}
-	return shortURL, nil
+	return opts.CustomAlias, nil
+}
+
+// assignCode saves url under a free generated code. With reuse, a live link of the same owner
+// and destination already holding the code is returned instead, which keeps repeated hash-mode
+// requests on one code.
+func (s *urlService) assignCode(url *model.URL, reuse bool) error {
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, taken, err := s.freeCode(url.OriginalURL, attempt)
+		if err != nil {
+			return err
+		}
+		if taken != nil {
+			if reuse && !taken.DeletedAt.Valid && taken.OriginalURL == url.OriginalURL && taken.UserID == url.UserID {
+				*url = *taken
+				return nil
+			}
+			continue
+		}
+		if code == "" {
+			continue
+		}
+		url.ShortenedURL = code
+		err = s.repo.Save(url)
+		if errors.Is(err, domain.ErrConflict) {
+			// another request took the code between the lookup and the insert
+			continue
+		}
+		return err
+	}
+	return errNoFreeCode
+}
+
+// generateCode returns a generated code that no link uses yet
+func (s *urlService) generateCode(originalURL string) (string, error) {
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, _, err := s.freeCode(originalURL, attempt)
+		if err != nil || code != "" {
+			return code, err
+		}
+	}
+	return "", errNoFreeCode
+}
+
+// freeCode generates the code for attempt and returns it if nothing uses it as a short code or
+// alias. Otherwise code is empty and taken holds the link using it as a short code, if any.
+func (s *urlService) freeCode(originalURL string, attempt int) (code string, taken *model.URL, err error) {
+	code, err = s.codes.Generate(originalURL, attempt)
+	if err != nil {
+		return "", nil, err
+	}
+	if s.isReserved(code) {
+		return "", nil, nil
+	}
+	if existing, err := s.repo.FindByShortURL(code); err == nil {
+		return "", existing, nil
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return "", nil, err
+	}
+	if _, err := s.repo.FindByCustomAlias(code); err == nil {
+		return "", nil, nil
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return "", nil, err
+	}
+	return code, nil, nil
+}
+
+// checkAlias validates the alias format and makes sure no other link (other than selfID) uses it
+// as alias or code. It returns the folded key the alias is stored under.
+func (s *urlService) checkAlias(alias string, selfID uint) (string, error) {
+	if !isValidAlias(alias) {
+		return "", &domain.ValidationError{Field: "custom_alias", Message: "custom_alias must contain only letters, digits, dash or underscore"}
+	}
+	key := s.folding.fold(alias)
+	if s.isReserved(key) {
+		return "", fmt.Errorf("%w: %q can't be used", domain.ErrAliasReserved, alias)
+	}
+	if existing, err := s.repo.FindByCustomAlias(key); err == nil && existing.ID != selfID {
+		return "", domain.ErrAliasTaken
+	} else if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return "", err
+	}
+	if existing, err := s.repo.FindByShortURL(key); err == nil && existing.ID != selfID {
+		return "", domain.ErrAliasTaken
+	} else if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return "", err
+	}
+	return key, nil
+}
+
+// validateLimits checks optional expiration and click limit values
+func validateLimits(expiration *time.Time, maxClicks *uint64) error {
+	if expiration != nil && expiration.Before(time.Now()) {
+		return &domain.ValidationError{Field: "expiration", Message: "expiration must be in the future"}
+	}
+	if maxClicks != nil && *maxClicks == 0 {
+		return &domain.ValidationError{Field: "max_clicks", Message: "max_clicks must be > 0"}
+	}
+	return nil
+}
+
+// withUTM sets UTM query parameters on destination. Without override, parameters already present
+// in the destination win; with override, values replace them and empty values remove them.
+func withUTM(destination string, params map[string]string, override bool) (string, error) {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", domain.ErrInvalidURL, err)
+	}
+	q := parsed.Query()
+	for key, value := range params {
+		switch {
+		case override && value == "":
+			q.Del(key)
+		case value != "" && (override || q.Get(key) == ""):
+			q.Set(key, value)
+		}
+	}
+	parsed.RawQuery = q.Encode()
+	return parsed.String(), nil
+}
+
+// UpdateLink applies a partial update to a link owned by userID, re-running the shorten validation
+func (s *urlService) UpdateLink(id, userID uint, update domain.LinkUpdate) (*model.URL, error) {
+	urlObj, err := s.ownedLink(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if urlObj.DeletedAt.Valid {
+		return nil, domain.ErrDeleted
+	}
+
+	if update.CustomAlias != nil && *update.CustomAlias != urlObj.DisplayAlias() {
+		alias, key := *update.CustomAlias, ""
+		if alias != "" {
+			if key, err = s.checkAlias(alias, urlObj.ID); err != nil {
+				return nil, err
+			}
+		}
+		// Links created with an alias use it as their code too
+		if urlObj.ShortenedURL == urlObj.CustomAlias && key != urlObj.CustomAlias {
+			if key != "" {
+				urlObj.ShortenedURL = key
+			} else {
+				code, err := s.generateCode(urlObj.OriginalURL)
+				if err != nil {
+					return nil, err
+				}
+				urlObj.ShortenedURL = code
+			}
+		}
+		urlObj.CustomAlias = key
+		urlObj.CustomAliasDisplay = alias
+	}
+
+	if update.ClearExpiration {
+		urlObj.Expiration = nil
+	} else if update.Expiration != nil {
+		urlObj.Expiration = update.Expiration
+	}
+	if update.ClearMaxClicks {
+		urlObj.MaxClicks = nil
+	} else if update.MaxClicks != nil {
+		urlObj.MaxClicks = update.MaxClicks
+	}
+	if err := validateLimits(update.Expiration, update.MaxClicks); err != nil {
+		return nil, err
+	}
+	if update.ClearActivatesAt {
+		urlObj.ActivatesAt = nil
+	} else if update.ActivatesAt != nil {
+		urlObj.ActivatesAt = update.ActivatesAt
+	}
+	if err := validateSchedule(urlObj.ActivatesAt, urlObj.Expiration); err != nil {
+		return nil, err
+	}
+	if update.FallbackURL != nil {
+		urlObj.FallbackURL = *update.FallbackURL
+	}
+	if update.ExpiredPage != nil {
+		urlObj.ExpiredPage = *update.ExpiredPage
+	}
+	if update.FallbackURL != nil || update.ExpiredPage != nil {
+		if urlObj.FallbackURL, err = s.checkFallback(urlObj.FallbackURL, urlObj.ExpiredPage); err != nil {
+			return nil, err
+		}
+	}
+	if update.ComingSoonURL != nil {
+		urlObj.ComingSoonURL = *update.ComingSoonURL
+		if urlObj.ComingSoonURL != "" {
+			if urlObj.ComingSoonURL, err = s.checkComingSoonURL(urlObj.ComingSoonURL); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if update.Title != nil {
+		if len(*update.Title) > maxTitleLength {
+			return nil, &domain.ValidationError{Field: "title", Message: fmt.Sprintf("title must be at most %d characters", maxTitleLength)}
+		}
+		urlObj.Title = *update.Title
+	}
+	if update.ForcePreview != nil {
+		urlObj.ForcePreview = *update.ForcePreview
+	}
+	if update.RedirectType != nil {
+		if err := validateRedirectType(*update.RedirectType); err != nil {
+			return nil, err
+		}
+		urlObj.RedirectType = *update.RedirectType
+	}
+	if update.QueryPassthrough != nil {
+		if err := validateQueryPassthrough(*update.QueryPassthrough); err != nil {
+			return nil, err
+		}
+		urlObj.QueryPassthrough = *update.QueryPassthrough
+	}
+	if update.PathPassthrough != nil {
+		urlObj.PathPassthrough = *update.PathPassthrough
+	}
+	if update.Password != nil {
+		if urlObj.PasswordHash, err = hashLinkPassword(*update.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	utm := map[string]string{}
+	if update.UTMSource != nil {
+		urlObj.UTMSource = *update.UTMSource
+		utm["utm_source"] = urlObj.UTMSource
+	}
+	if update.UTMMedium != nil {
+		urlObj.UTMMedium = *update.UTMMedium
+		utm["utm_medium"] = urlObj.UTMMedium
+	}
+	if update.UTMCampaign != nil {
+		urlObj.UTMCampaign = *update.UTMCampaign
+		utm["utm_campaign"] = urlObj.UTMCampaign
+	}
+	if update.OriginalURL != nil {
+		var dest string
+		if dest, err = s.dests.Normalize(*update.OriginalURL); err != nil {
+			return nil, err
+		}
+		// A new destination gets the link's UTM parameters the same way ShortenWithOptions adds them
+		urlObj.OriginalURL, err = withUTM(dest, map[string]string{
+			"utm_source":   urlObj.UTMSource,
+			"utm_medium":   urlObj.UTMMedium,
+			"utm_campaign": urlObj.UTMCampaign,
+		}, false)
+	} else if len(utm) > 0 {
+		urlObj.OriginalURL, err = withUTM(urlObj.OriginalURL, utm, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	wasQuarantined := urlObj.Quarantined
+	if update.OriginalURL != nil {
+		if err := s.screen(urlObj); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.Update(urlObj); err != nil {
+		return nil, err
+	}
+	// A new destination was screened again, which may flag the link or lift its flag
+	if update.OriginalURL != nil {
+		if urlObj.Quarantined {
+			err = s.repo.Quarantine(urlObj.ID, urlObj.QuarantineReason)
+		} else if wasQuarantined {
+			err = s.repo.ClearQuarantine(urlObj.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return urlObj, nil
 }
 
 func (s *urlService) GetURLsByUser(userID uint) ([]model.URL, error) {
@@ -158,21 +627,73 @@ func (s *urlService) GetURLsByUser(userID uint) ([]model.URL, error) {
 }
 
 func (s *urlService) GetStats(shortURL string) (*model.URL, error) {
-	return s.repo.FindByShortURL(shortURL)
+	urlObj, err := s.findLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	// Caches keep links across clicks, so read the counters from the database
+	current, err := s.repo.FindByID(urlObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	urlObj.ClickCount, urlObj.LastClickedAt = current.ClickCount, current.LastClickedAt
+	return urlObj, nil
+}
+
+// newClick builds the click log entry for a visit
+func (s *urlService) newClick(urlID uint, at time.Time, visit domain.Visit) model.Click {
+	ua := useragent.Parse(visit.UserAgent)
+	click := model.Click{
+		URLID:          urlID,
+		ClickedAt:      at,
+		Referrer:       visit.Referrer,
+		UserAgent:      visit.UserAgent,
+		IPHash:         s.hashIP(visit.IP, at),
+		AcceptLanguage: visit.AcceptLanguage,
+		ReferrerDomain: useragent.ReferrerDomain(visit.Referrer),
+		Device:         ua.Device,
+		Browser:        ua.Browser,
+		OS:             ua.OS,
+	}
+	if s.geo != nil && visit.IP != "" {
+		click.Country, click.City, _ = s.geo.Locate(visit.IP)
+	}
+	return click
+}
+
+// saveClick appends the click to the log; failures are logged but never block the redirect
+func (s *urlService) saveClick(click model.Click) {
+	if s.clicks == nil {
+		return
+	}
+	if err := s.clicks.Save(&click); err != nil {
+		log.Printf("failed to record click for url %d: %v", click.URLID, err)
+	}
+}
+
+// hashIP keeps raw client addresses out of the click log. The hash is keyed, since the IPv4 space
+// is small enough to reverse a plain one, and the key changes every rotation period, so hashes
+// can only be matched up within a period. Without a key no address is recorded.
+func (s *urlService) hashIP(ip string, at time.Time) string {
+	if ip == "" || len(s.ipKey) == 0 {
+		return ""
+	}
+	key := s.ipKey
+	if s.ipKeyRotation > 0 {
+		period := at.Unix() / int64(s.ipKeyRotation/time.Second)
+		key = keyedHash(s.ipKey, "period:"+strconv.FormatInt(period, 10))
+	}
+	return hex.EncodeToString(keyedHash(key, ip))
 }
 
-func (s *urlService) generateShortURL(originalURL string) string {
-	hasher := sha1.New()
-	hasher.Write([]byte(originalURL))
-	sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-	return sha[:8]
+func keyedHash(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
 }
 
-func (s *urlService) generateShortURLWithTimestamp(originalURL string) string {
-	hasher := sha1.New()
-	hasher.Write([]byte(originalURL + time.Now().String()))
-	sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-	return sha[:8]
+func (s *urlService) isReserved(alias string) bool {
+	return s.reserved != nil && s.reserved.IsReserved(alias)
 }
 
 // isValidAlias checks alias strings (alphanumeric, dash, underscore)
@@ -1,12 +1,18 @@
 package service_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"testing"
 	"time"
 
+	"url-shortener/internal/destination"
+	"url-shortener/internal/domain"
 	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
 	"url-shortener/internal/service"
+	"url-shortener/internal/shortcode"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -16,15 +22,31 @@ import (
 func setupDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
-	err = db.AutoMigrate(&model.User{}, &model.URL{})
+	err = db.AutoMigrate(&model.User{}, &model.URL{}, &model.Click{}, &model.RedirectRule{}, &model.LinkVariant{})
 	assert.NoError(t, err)
 	return db
 }
 
-func TestShortenURLAndRedirect(t *testing.T) {
+// fixture is a fresh database with the repositories a URL service is built on
+type fixture struct {
+	db     *gorm.DB
+	repo   domain.URLRepository
+	clicks domain.ClickRepository
+}
+
+func newFixture(t *testing.T) *fixture {
 	db := setupDB(t)
-	repo := repository.NewURLRepository(db)
-	svc := service.NewURLService(repo)
+	return &fixture{db: db, repo: repository.NewURLRepository(db), clicks: repository.NewClickRepository(db)}
+}
+
+// service builds a URL service over the fixture's repositories
+func (f *fixture) service(opts ...service.URLServiceOption) domain.URLService {
+	return service.NewURLService(f.repo, f.clicks, opts...)
+}
+
+func TestShortenURLAndRedirect(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
 
 	// Test shorten
 	orig := "https://example.com"
@@ -33,12 +55,12 @@ func TestShortenURLAndRedirect(t *testing.T) {
 	assert.Len(t, token, 8)
 
 	// Verify stored
-	urlObj, err := repo.FindByShortURL(token)
+	urlObj, err := f.repo.FindByShortURL(token)
 	assert.NoError(t, err)
 	assert.Equal(t, orig, urlObj.OriginalURL)
 
 	// Test redirect increments click count
-	resURL, err := svc.Redirect(token)
+	resURL, err := svc.Redirect(token, domain.Visit{})
 	assert.NoError(t, err)
 	assert.Equal(t, orig, resURL)
 
@@ -50,9 +72,8 @@ func TestShortenURLAndRedirect(t *testing.T) {
 }
 
 func TestDuplicateShorten(t *testing.T) {
-	db := setupDB(t)
-	repo := repository.NewURLRepository(db)
-	svc := service.NewURLService(repo)
+	f := newFixture(t)
+	svc := f.service()
 
 	orig := "https://duplicate.com"
 	t1, err := svc.ShortenForUser(orig, 0)
@@ -63,14 +84,13 @@ func TestDuplicateShorten(t *testing.T) {
 
 	// Only one record in DB
 	var urls []model.URL
-	db.Find(&urls)
+	f.db.Find(&urls)
 	assert.Len(t, urls, 1)
 }
 
 func TestShortenForUser(t *testing.T) {
-	db := setupDB(t)
-	repo := repository.NewURLRepository(db)
-	svc := service.NewURLService(repo)
+	f := newFixture(t)
+	svc := f.service()
 
 	userID := uint(42)
 	orig1 := "https://user.com/page1"
@@ -86,3 +106,219 @@ func TestShortenForUser(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, urls, 2)
 }
+
+func TestUpdateLink(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service()
+
+	owner := uint(7)
+	maxClicks := uint64(10)
+	token, err := svc.ShortenWithOptions("https://exmaple.com/sale", owner, "sale", nil, &maxClicks, "newsletter", "", "")
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	_, err = svc.ShortenWithOptions("https://example.com/other", owner, "taken", nil, nil, "", "", "")
+	assert.NoError(t, err)
+
+	// Only the owner may edit
+	dest := "https://example.com/sale"
+	_, err = svc.UpdateLink(urlObj.ID, owner+1, domain.LinkUpdate{OriginalURL: &dest})
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	// Fixing the destination keeps the link's UTM parameters
+	updated, err := svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{OriginalURL: &dest, ClearMaxClicks: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/sale?utm_source=newsletter", updated.OriginalURL)
+	assert.Nil(t, updated.MaxClicks)
+
+	// Changing a UTM field rewrites the stored destination
+	campaign := "winter"
+	updated, err = svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{UTMCampaign: &campaign})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/sale?utm_campaign=winter&utm_source=newsletter", updated.OriginalURL)
+
+	// Alias changes are validated and move the code with them
+	taken := "taken"
+	_, err = svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{CustomAlias: &taken})
+	assert.ErrorIs(t, err, domain.ErrAliasTaken)
+	bad := "no spaces"
+	_, err = svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{CustomAlias: &bad})
+	assert.Error(t, err)
+	alias := "winter-sale"
+	updated, err = svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{CustomAlias: &alias})
+	assert.NoError(t, err)
+	assert.Equal(t, "winter-sale", updated.ShortenedURL)
+	got, err := svc.Redirect("winter-sale", domain.Visit{})
+	assert.NoError(t, err)
+	assert.Equal(t, updated.OriginalURL, got)
+	_, err = svc.Redirect("sale", domain.Visit{})
+	assert.Error(t, err)
+
+	// Limits are validated like at creation time
+	zero := uint64(0)
+	_, err = svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{MaxClicks: &zero})
+	assert.Error(t, err)
+	past := time.Now().Add(-time.Hour)
+	_, err = svc.UpdateLink(urlObj.ID, owner, domain.LinkUpdate{Expiration: &past})
+	assert.Error(t, err)
+}
+
+// interleavedLookups runs between once, right after the next FindByID, as if another request
+// changed the link while an edit was in progress
+type interleavedLookups struct {
+	domain.URLRepository
+	between func()
+}
+
+func (r *interleavedLookups) FindByID(id uint) (*model.URL, error) {
+	urlObj, err := r.URLRepository.FindByID(id)
+	if between := r.between; between != nil {
+		r.between = nil
+		between()
+	}
+	return urlObj, err
+}
+
+func TestUpdateLinkKeepsConcurrentChanges(t *testing.T) {
+	f := newFixture(t)
+	repo := &interleavedLookups{URLRepository: f.repo}
+	svc := service.NewURLService(repo, f.clicks, service.WithVariants(repository.NewVariantRepository(f.db)))
+
+	once := uint64(1)
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://once.com", UserID: 5, MaxClicks: &once})
+	assert.NoError(t, err)
+	urlObj, err := repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	// The link is used up and gets a variant after the edit read it
+	repo.between = func() {
+		_, err := svc.Redirect(token, domain.Visit{})
+		assert.NoError(t, err)
+		_, err = svc.AddVariant(urlObj.ID, 5, model.LinkVariant{Destination: "https://once.com/a", Weight: 1})
+		assert.NoError(t, err)
+	}
+	title := "One-time"
+	_, err = svc.UpdateLink(urlObj.ID, 5, domain.LinkUpdate{Title: &title})
+	assert.NoError(t, err)
+
+	stored, err := repo.FindByShortURL(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "One-time", stored.Title)
+	assert.Equal(t, uint64(1), stored.ClickCount)
+	assert.True(t, stored.HasVariants)
+	_, err = svc.Redirect(token, domain.Visit{})
+	assert.ErrorIs(t, err, domain.ErrClickLimit)
+}
+
+// fixedCodes hands out code0, code1, ... by attempt, whatever the URL
+type fixedCodes struct{}
+
+func (fixedCodes) Generate(_ string, attempt int) (string, error) {
+	return "code" + strconv.Itoa(attempt), nil
+}
+
+func TestShortCodeCollisions(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithCodeGenerator(fixedCodes{}))
+
+	a, err := svc.ShortenForUser("https://a.com", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "code0", a)
+	again, err := svc.ShortenForUser("https://a.com", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, a, again)
+
+	// Taken codes and aliases are skipped
+	_, err = svc.ShortenWithOptions("https://alias.com", 0, "code2", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	b, err := svc.ShortenForUser("https://b.com", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "code1", b)
+	c, err := svc.ShortenWithOptions("https://c.com", 0, "", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "code3", c)
+
+	for i := 0; i < 4; i++ {
+		_, err = svc.Shorten(fmt.Sprintf("https://fill%d.com", i))
+		assert.NoError(t, err)
+	}
+	_, err = svc.Shorten("https://full.com")
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+}
+
+func TestSequenceShortCodes(t *testing.T) {
+	f := newFixture(t)
+	assert.NoError(t, f.db.AutoMigrate(&model.Sequence{}))
+	codes, err := shortcode.New(shortcode.Config{Strategy: shortcode.StrategySequence, Length: 6}, repository.NewSequenceRepository(f.db))
+	assert.NoError(t, err)
+	svc := f.service(service.WithCodeGenerator(codes))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		// Same destination every time: sequence codes never dedupe across owners
+		token, err := svc.ShortenForUser("https://same.com", uint(i+1))
+		assert.NoError(t, err)
+		assert.Len(t, token, 6)
+		assert.False(t, seen[token])
+		seen[token] = true
+	}
+	var seq model.Sequence
+	assert.NoError(t, f.db.First(&seq, "name = ?", shortcode.SequenceName).Error)
+	assert.Equal(t, uint64(50), seq.Value)
+}
+
+func TestShortenValidatesDestination(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(service.WithDestinationValidator(destination.New(destination.Config{SelfHosts: []string{"sho.rt"}})))
+
+	for _, dest := range []string{"", "javascript:alert(1)", "/local", "https://sho.rt/abc"} {
+		_, err := svc.ShortenWithOptions(dest, 0, "", nil, nil, "", "", "")
+		var verr *domain.ValidationError
+		if assert.ErrorAs(t, err, &verr, dest) {
+			assert.Equal(t, "url", verr.Field)
+		}
+	}
+
+	// Destinations are stored normalized, so spelling variants dedupe
+	t1, err := svc.ShortenForUser("HTTPS://Example.com:443/a", 0)
+	assert.NoError(t, err)
+	t2, err := svc.ShortenForUser("https://example.com/a", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, t1, t2)
+	urlObj, err := svc.GetStats(t1)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", urlObj.OriginalURL)
+
+	_, err = svc.ShortenWithOptions("https://example.com", 5, "mine", nil, nil, "", "", "")
+	assert.NoError(t, err)
+	urls, err := svc.GetURLsByUser(5)
+	assert.NoError(t, err)
+	loop := "https://sho.rt/mine"
+	_, err = svc.UpdateLink(urls[0].ID, 5, domain.LinkUpdate{OriginalURL: &loop})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestLinkStates(t *testing.T) {
+	now := time.Now()
+	future, past := now.Add(time.Hour), now.Add(-time.Hour)
+	limit := uint64(3)
+	tests := []struct {
+		link  model.URL
+		state string
+	}{
+		{model.URL{}, model.LinkStateActive},
+		{model.URL{ActivatesAt: &future}, model.LinkStateScheduled},
+		{model.URL{ActivatesAt: &past, Expiration: &future}, model.LinkStateActive},
+		{model.URL{Expiration: &past}, model.LinkStateExpired},
+		{model.URL{MaxClicks: &limit, ClickCount: 3}, model.LinkStateExhausted},
+		{model.URL{DeletedAt: gorm.DeletedAt{Time: past, Valid: true}}, model.LinkStateDeleted},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.state, tt.link.StateAt(now))
+	}
+
+	// Listings carry the state
+	raw, err := json.Marshal([]model.URL{{ActivatesAt: &future}})
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"state":"scheduled"`)
+}
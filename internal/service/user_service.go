@@ -5,6 +5,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"time"
+	"url-shortener/internal/domain"
 	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
 )
@@ -35,13 +36,13 @@ func (s *UserService) Register(username, password string) (model.User, error) {
 func (s *UserService) Login(username, password string) (string, error) {
 	user, err := s.repo.GetUserByUsername(username)
 	if err != nil {
-		if err.Error() == "user not found" {
-			return "", errors.New("invalid credentials")
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", domain.ErrInvalidCredentials
 		}
 		return "", err
 	}
 	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
-		return "", errors.New("invalid credentials")
+		return "", domain.ErrInvalidCredentials
 	}
 	claims := jwt.MapClaims{
 		"user_id": float64(user.ID), // Ensure consistent type
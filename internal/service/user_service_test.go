@@ -4,6 +4,7 @@ import (
 	"testing"
 	//"time"
 
+	"url-shortener/internal/domain"
 	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
 	"url-shortener/internal/service"
@@ -13,7 +14,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func setupDB(t *testing.T) *gorm.DB {
+func setupUserDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 	err = db.AutoMigrate(&model.User{})
@@ -22,7 +23,7 @@ func setupDB(t *testing.T) *gorm.DB {
 }
 
 func TestRegisterAndLogin(t *testing.T) {
-	db := setupDB(t)
+	db := setupUserDB(t)
 	repo := repository.NewUserRepository(db)
 	us := service.NewUserService(repo)
 
@@ -33,7 +34,7 @@ func TestRegisterAndLogin(t *testing.T) {
 
 	// Duplicate registration should fail
 	_, err = us.Register("testuser", "password123")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, domain.ErrUsernameTaken)
 
 	// Successful login
 	token, err := us.Login("testuser", "password123")
@@ -42,11 +43,11 @@ func TestRegisterAndLogin(t *testing.T) {
 
 	// Invalid password
 	_, err = us.Login("testuser", "wrongpass")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
 
 	// Non-existent user
 	_, err = us.Login("nouser", "password")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
 
 	// Login token should expire in ~24h
 	// Extract claims to verify exp (basic check)
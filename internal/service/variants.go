@@ -0,0 +1,241 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+)
+
+// maxVariantsPerLink bounds the destinations a link's visitors are split over
+const maxVariantsPerLink = 10
+
+// maxVariantWeight keeps weights readable as percentages or per-mille shares
+const maxVariantWeight = 1000
+
+// WithVariants splits visitors of links over weighted A/B destinations; without it links only have OriginalURL
+func WithVariants(variants domain.VariantRepository) URLServiceOption {
+	return func(s *urlService) {
+		s.variants = variants
+	}
+}
+
+func (s *urlService) ListVariants(linkID, userID uint) ([]model.LinkVariant, error) {
+	urlObj, err := s.variantLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.variants.FindByURLID(urlObj.ID)
+}
+
+func (s *urlService) AddVariant(linkID, userID uint, variant model.LinkVariant) (*model.LinkVariant, error) {
+	urlObj, err := s.variantLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateVariant(&variant); err != nil {
+		return nil, err
+	}
+	existing, err := s.variants.FindByURLID(urlObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxVariantsPerLink {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("a link can have at most %d variants", maxVariantsPerLink)}
+	}
+	variant.ID, variant.URLID = 0, urlObj.ID
+	if err := s.variants.Save(&variant); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetHasVariants(urlObj.ID, true); err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (s *urlService) UpdateVariant(linkID, variantID, userID uint, variant model.LinkVariant) (*model.LinkVariant, error) {
+	urlObj, err := s.variantLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.ownedVariant(urlObj, variantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateVariant(&variant); err != nil {
+		return nil, err
+	}
+	variant.ID, variant.URLID, variant.CreatedAt = current.ID, current.URLID, current.CreatedAt
+	if err := s.variants.Update(&variant); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetHasVariants(urlObj.ID, true); err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (s *urlService) DeleteVariant(linkID, variantID, userID uint) error {
+	urlObj, err := s.variantLink(linkID, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.ownedVariant(urlObj, variantID); err != nil {
+		return err
+	}
+	if err := s.variants.Delete(variantID); err != nil {
+		return err
+	}
+	remaining, err := s.variants.FindByURLID(urlObj.ID)
+	if err != nil {
+		return err
+	}
+	return s.repo.SetHasVariants(urlObj.ID, len(remaining) > 0)
+}
+
+// GetVariantStats reports each variant's configured share of visitors next to the clicks it got.
+// Clicks of deleted variants still count towards the total, so shares reflect all split traffic.
+func (s *urlService) GetVariantStats(shortURL string) ([]domain.VariantStats, error) {
+	if s.variants == nil {
+		return nil, nil
+	}
+	urlObj, err := s.findLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	if !urlObj.HasVariants {
+		return nil, nil
+	}
+	variants, err := s.variants.FindByURLID(urlObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	clicks := map[uint]uint64{}
+	var clickTotal uint64
+	if s.clicks != nil {
+		counts, err := s.clicks.CountBy(urlObj.ID, domain.ClickFieldVariant, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range counts {
+			id, err := strconv.ParseUint(c.Value, 10, 64)
+			if err != nil || id == 0 {
+				continue
+			}
+			clicks[uint(id)] = c.Count
+			clickTotal += c.Count
+		}
+	}
+	weightTotal := 0
+	for _, v := range variants {
+		weightTotal += v.Weight
+	}
+	stats := make([]domain.VariantStats, len(variants))
+	for i, v := range variants {
+		stats[i] = domain.VariantStats{Variant: v, Clicks: clicks[v.ID]}
+		if weightTotal > 0 {
+			stats[i].WeightPercent = float64(v.Weight) * 100 / float64(weightTotal)
+		}
+		if clickTotal > 0 {
+			stats[i].ClickPercent = float64(stats[i].Clicks) * 100 / float64(clickTotal)
+		}
+	}
+	return stats, nil
+}
+
+// variantLink finds a link owned by userID whose variants can be managed
+func (s *urlService) variantLink(linkID, userID uint) (*model.URL, error) {
+	if s.variants == nil {
+		return nil, fmt.Errorf("link variants are not stored: %w", domain.ErrUnavailable)
+	}
+	urlObj, err := s.ownedLink(linkID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if urlObj.DeletedAt.Valid {
+		return nil, domain.ErrDeleted
+	}
+	return urlObj, nil
+}
+
+func (s *urlService) ownedVariant(urlObj *model.URL, variantID uint) (*model.LinkVariant, error) {
+	variant, err := s.variants.FindByID(variantID)
+	if err != nil {
+		return nil, err
+	}
+	if variant.URLID != urlObj.ID {
+		return nil, domain.ErrNotFound
+	}
+	return variant, nil
+}
+
+// validateVariant checks a variant and normalizes its destination
+func (s *urlService) validateVariant(variant *model.LinkVariant) error {
+	dest, err := s.normalizeAs("destination", variant.Destination)
+	if err != nil {
+		return err
+	}
+	if err := s.screenDestination(dest); err != nil {
+		return err
+	}
+	variant.Destination = dest
+	variant.Label = strings.TrimSpace(variant.Label)
+	if len(variant.Label) > 64 {
+		return &domain.ValidationError{Field: "label", Message: "label must be at most 64 characters"}
+	}
+	if variant.Weight < 1 || variant.Weight > maxVariantWeight {
+		return &domain.ValidationError{Field: "weight", Message: fmt.Sprintf("weight must be between 1 and %d", maxVariantWeight)}
+	}
+	return nil
+}
+
+// pickVariant splits visitors of urlObj over its variants by weight and returns the visitor ID
+// the choice was made for. The same visitor ID always lands on the same variant as long as the
+// variants don't change; visits without one are spread at random. The variant is nil when the
+// link has no variants. The variants come with the link, see URLRepository.FindByShortURL.
+func (s *urlService) pickVariant(urlObj *model.URL, visit domain.Visit) (*model.LinkVariant, string) {
+	if !urlObj.HasVariants || s.variants == nil {
+		return nil, ""
+	}
+	variants := urlObj.Variants
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return nil, ""
+	}
+	var n uint64
+	visitorID := s.visitorID(visit)
+	if visitorID != "" {
+		sum := sha256.Sum256([]byte(strconv.FormatUint(uint64(urlObj.ID), 10) + ":" + visitorID))
+		n = binary.BigEndian.Uint64(sum[:8]) % uint64(total)
+	} else {
+		n = rand.Uint64N(uint64(total))
+	}
+	for i := range variants {
+		if n < uint64(variants[i].Weight) {
+			return &variants[i], visitorID
+		}
+		n -= uint64(variants[i].Weight)
+	}
+	return nil, ""
+}
+
+// visitorID identifies a visitor for sticky variants: the ID they were given before, or else one
+// derived from their IP address when there is a key to hash it with. Handing the derived ID out as
+// their ID keeps them on the same variants when their address changes later.
+func (s *urlService) visitorID(visit domain.Visit) string {
+	if visit.VisitorID != "" {
+		return visit.VisitorID
+	}
+	if visit.IP != "" && len(s.ipKey) > 0 {
+		return "ip-" + hex.EncodeToString(keyedHash(s.ipKey, "visitor:"+visit.IP))[:32]
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestABVariants(t *testing.T) {
+	f := newFixture(t)
+	svc := f.service(
+		service.WithVariants(repository.NewVariantRepository(f.db)), service.WithIPHashKey([]byte("ip-key"), time.Hour))
+
+	token, err := svc.ShortenLink(domain.ShortenOptions{OriginalURL: "https://shop.com", UserID: 7, RedirectType: domain.RedirectPermanent})
+	assert.NoError(t, err)
+	urlObj, err := f.repo.FindByShortURL(token)
+	assert.NoError(t, err)
+
+	_, err = svc.AddVariant(urlObj.ID, 7, model.LinkVariant{Destination: "https://shop.com/a", Weight: 0})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	_, err = svc.AddVariant(urlObj.ID, 8, model.LinkVariant{Destination: "https://shop.com/a", Weight: 70})
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	a, err := svc.AddVariant(urlObj.ID, 7, model.LinkVariant{Label: "A", Destination: "https://shop.com/a", Weight: 70})
+	assert.NoError(t, err)
+	b, err := svc.AddVariant(urlObj.ID, 7, model.LinkVariant{Label: "B", Destination: "https://shop.com/b", Weight: 30})
+	assert.NoError(t, err)
+
+	// The same visitor keeps getting the same variant, and no redirect is cached
+	first, err := svc.Follow(token, domain.Visit{VisitorID: "visitor-1"})
+	assert.NoError(t, err)
+	assert.NotZero(t, first.VariantID)
+	assert.Zero(t, first.MaxAge)
+	for range 5 {
+		again, err := svc.Follow(token, domain.Visit{VisitorID: "visitor-1"})
+		assert.NoError(t, err)
+		assert.Equal(t, first.URL, again.URL)
+	}
+
+	// Visitors without an ID stick by address, and keep their variant with the ID they are given
+	byIP, err := svc.Follow(token, domain.Visit{IP: "203.0.113.50"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, byIP.VisitorID)
+	for range 3 {
+		again, err := svc.Follow(token, domain.Visit{IP: "203.0.113.50"})
+		assert.NoError(t, err)
+		assert.Equal(t, byIP.VariantID, again.VariantID)
+		assert.Equal(t, byIP.VisitorID, again.VisitorID)
+	}
+	moved, err := svc.Follow(token, domain.Visit{IP: "192.0.2.77", VisitorID: byIP.VisitorID})
+	assert.NoError(t, err)
+	assert.Equal(t, byIP.VariantID, moved.VariantID)
+
+	seen := map[uint]int{}
+	for i := range 400 {
+		target, err := svc.Follow(token, domain.Visit{IP: fmt.Sprintf("198.51.100.%d", i%250), VisitorID: fmt.Sprint(i)})
+		assert.NoError(t, err)
+		seen[target.VariantID]++
+	}
+	assert.InDelta(t, 280, seen[a.ID], 50)
+	assert.InDelta(t, 120, seen[b.ID], 50)
+
+	stats, err := svc.GetVariantStats(token)
+	assert.NoError(t, err)
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, 70.0, stats[0].WeightPercent)
+		assert.Equal(t, 30.0, stats[1].WeightPercent)
+		assert.Equal(t, uint64(411), stats[0].Clicks+stats[1].Clicks)
+		assert.InDelta(t, 100, stats[0].ClickPercent+stats[1].ClickPercent, 0.001)
+	}
+
+	// Removing every variant sends visitors to the link's own destination again
+	assert.NoError(t, svc.DeleteVariant(urlObj.ID, a.ID, 7))
+	assert.NoError(t, svc.DeleteVariant(urlObj.ID, b.ID, 7))
+	target, err := svc.Follow(token, domain.Visit{VisitorID: "visitor-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://shop.com", target.URL)
+	assert.Zero(t, target.VariantID)
+	assert.NotZero(t, target.MaxAge)
+}
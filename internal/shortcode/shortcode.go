@@ -0,0 +1,230 @@
+// Package shortcode generates the codes that identify short links.
+package shortcode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+	"url-shortener/internal/domain"
+)
+
+// Strategies accepted by New
+const (
+	StrategyHash     = "hash"     // derived from the destination URL, so repeated requests get the same code
+	StrategyRandom   = "random"   // drawn from crypto/rand
+	StrategySequence = "sequence" // base-N encoding of a database counter
+)
+
+const (
+	// Base62 is the default alphabet
+	Base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// DefaultLength is the default code length
+	DefaultLength = 8
+	// SequenceName is the counter used by the sequence strategy
+	SequenceName = "short_code"
+
+	minLength = 4
+	maxLength = 64
+)
+
+// Config selects and tunes a strategy; zero values fall back to hash, Base62 and DefaultLength
+type Config struct {
+	Strategy string
+	Length   int
+	Alphabet string
+}
+
+// New builds the generator described by cfg. seq is only needed by the sequence strategy.
+func New(cfg Config, seq domain.SequenceRepository) (domain.CodeGenerator, error) {
+	if cfg.Strategy == "" {
+		cfg.Strategy = StrategyHash
+	}
+	if cfg.Length == 0 {
+		cfg.Length = DefaultLength
+	}
+	if cfg.Alphabet == "" {
+		cfg.Alphabet = Base62
+	}
+	if cfg.Length < minLength || cfg.Length > maxLength {
+		return nil, fmt.Errorf("code length must be between %d and %d", minLength, maxLength)
+	}
+	if err := validateAlphabet(cfg.Alphabet); err != nil {
+		return nil, err
+	}
+	switch cfg.Strategy {
+	case StrategyHash:
+		return NewHashGenerator(cfg.Alphabet, cfg.Length), nil
+	case StrategyRandom:
+		return NewRandomGenerator(cfg.Alphabet, cfg.Length), nil
+	case StrategySequence:
+		if seq == nil {
+			return nil, fmt.Errorf("the sequence strategy needs a sequence repository")
+		}
+		return NewSequenceGenerator(seq, cfg.Alphabet, cfg.Length), nil
+	}
+	return nil, fmt.Errorf("unknown code strategy %q", cfg.Strategy)
+}
+
+// validateAlphabet accepts at least two distinct characters that are safe in a URL path and in aliases
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return fmt.Errorf("alphabet must have between 2 and 256 characters")
+	}
+	seen := make(map[rune]bool, len(alphabet))
+	for _, c := range alphabet {
+		if !(c == '-' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return fmt.Errorf("alphabet may only contain letters, digits, dash or underscore, got %q", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("alphabet repeats %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// HashGenerator derives codes from a SHA-256 of the destination; later attempts salt the input
+type HashGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewHashGenerator expects an alphabet and length already checked by New
+func NewHashGenerator(alphabet string, length int) *HashGenerator {
+	return &HashGenerator{alphabet: alphabet, length: length}
+}
+
+func (g *HashGenerator) Generate(originalURL string, attempt int) (string, error) {
+	input := originalURL
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+	return pick(g.alphabet, g.length, &hashStream{seed: []byte(input)})
+}
+
+// hashStream is an endless deterministic byte source: SHA-256(seed || counter) blocks
+type hashStream struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func (s *hashStream) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(s.buf) == 0 {
+			block := binary.BigEndian.AppendUint64(append([]byte{}, s.seed...), s.counter)
+			sum := sha256.Sum256(block)
+			s.buf = sum[:]
+			s.counter++
+		}
+		c := copy(p[n:], s.buf)
+		s.buf = s.buf[c:]
+		n += c
+	}
+	return len(p), nil
+}
+
+// RandomGenerator draws every character from crypto/rand
+type RandomGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewRandomGenerator expects an alphabet and length already checked by New
+func NewRandomGenerator(alphabet string, length int) *RandomGenerator {
+	return &RandomGenerator{alphabet: alphabet, length: length}
+}
+
+func (g *RandomGenerator) Generate(string, int) (string, error) {
+	return pick(g.alphabet, g.length, rand.Reader)
+}
+
+// pick builds a code from src, rejecting bytes that would bias the result towards the start of the alphabet
+func pick(alphabet string, length int, src io.Reader) (string, error) {
+	base := len(alphabet)
+	limit := 256 - 256%base
+	code := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(code) < length {
+		if _, err := io.ReadFull(src, buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < length {
+				code = append(code, alphabet[int(b)%base])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// SequenceGenerator encodes the next value of a database counter. Values that fit in length
+// characters are permuted first so consecutive links don't get adjacent codes; the permutation is
+// a bijection, so codes stay unique. Once the counter outgrows that space codes get longer.
+type SequenceGenerator struct {
+	seq      domain.SequenceRepository
+	alphabet string
+	length   int
+	space    uint64 // number of values encoded in exactly length characters, capped to fit uint64
+	mult     uint64 // coprime with space
+}
+
+// NewSequenceGenerator expects an alphabet and length already checked by New
+func NewSequenceGenerator(seq domain.SequenceRepository, alphabet string, length int) *SequenceGenerator {
+	base := uint64(len(alphabet))
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		if space > math.MaxUint64/base {
+			break
+		}
+		space *= base
+	}
+	// Start from the 64-bit golden ratio and walk to the nearest value coprime with space
+	mult := uint64(0x9E3779B97F4A7C15) % space
+	for mult < 2 || gcd(mult, space) != 1 {
+		mult++
+		if mult >= space {
+			mult = 1
+		}
+	}
+	return &SequenceGenerator{seq: seq, alphabet: alphabet, length: length, space: space, mult: mult}
+}
+
+// Generate ignores attempt: every call draws a fresh value
+func (g *SequenceGenerator) Generate(string, int) (string, error) {
+	n, err := g.seq.Next(SequenceName)
+	if err != nil {
+		return "", err
+	}
+	return g.encode(n), nil
+}
+
+func (g *SequenceGenerator) encode(n uint64) string {
+	if n < g.space {
+		hi, lo := bits.Mul64(n, g.mult)
+		n = bits.Rem64(hi, lo, g.space)
+	}
+	base := uint64(len(g.alphabet))
+	var code []byte
+	for n > 0 || len(code) < g.length {
+		code = append(code, g.alphabet[n%base])
+		n /= base
+	}
+	// digits were produced least significant first
+	for i, j := 0, len(code)-1; i < j; i, j = i+1, j-1 {
+		code[i], code[j] = code[j], code[i]
+	}
+	return string(code)
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
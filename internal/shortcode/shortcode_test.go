@@ -0,0 +1,124 @@
+package shortcode_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"url-shortener/internal/shortcode"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memSequence is an in-memory domain.SequenceRepository
+type memSequence struct {
+	mu    sync.Mutex
+	value uint64
+}
+
+func (s *memSequence) Next(string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value++
+	return s.value, nil
+}
+
+func inAlphabet(code, alphabet string) bool {
+	for _, c := range code {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	_, err := shortcode.New(shortcode.Config{}, nil)
+	assert.NoError(t, err)
+
+	bad := []shortcode.Config{
+		{Strategy: "uuid"},
+		{Length: 2},
+		{Length: 65},
+		{Alphabet: "a"},
+		{Alphabet: "abca"},
+		{Alphabet: "ab/c"},
+		{Strategy: shortcode.StrategySequence},
+	}
+	for _, cfg := range bad {
+		_, err := shortcode.New(cfg, nil)
+		assert.Error(t, err, "%+v", cfg)
+	}
+}
+
+// Every strategy produces codes of at least the configured length, drawn only from the alphabet
+func TestCodesUseAlphabetAndLength(t *testing.T) {
+	for _, strategy := range []string{shortcode.StrategyHash, shortcode.StrategyRandom, shortcode.StrategySequence} {
+		property := func(url string, alphabetLen, length uint8) bool {
+			alphabet := shortcode.Base62[:2+int(alphabetLen)%61]
+			n := 4 + int(length)%20
+			gen, err := shortcode.New(shortcode.Config{Strategy: strategy, Length: n, Alphabet: alphabet}, &memSequence{})
+			if err != nil {
+				return false
+			}
+			code, err := gen.Generate(url, 0)
+			return err == nil && len(code) >= n && inAlphabet(code, alphabet)
+		}
+		assert.NoError(t, quick.Check(property, nil), strategy)
+	}
+}
+
+// Hash codes are stable for a URL and attempt, and change with the attempt
+func TestHashCodesAreDeterministic(t *testing.T) {
+	gen, err := shortcode.New(shortcode.Config{Strategy: shortcode.StrategyHash}, nil)
+	require.NoError(t, err)
+	property := func(url string) bool {
+		a, _ := gen.Generate(url, 0)
+		b, _ := gen.Generate(url, 0)
+		c, _ := gen.Generate(url, 1)
+		return a == b && a != c && len(a) == shortcode.DefaultLength
+	}
+	assert.NoError(t, quick.Check(property, nil))
+}
+
+// The sequence strategy never repeats a code, including after the counter outgrows the
+// configured length
+func TestSequenceCodesAreUnique(t *testing.T) {
+	for _, alphabet := range []string{"ab", "abc", shortcode.Base62} {
+		seq := &memSequence{}
+		gen, err := shortcode.New(shortcode.Config{Strategy: shortcode.StrategySequence, Length: 4, Alphabet: alphabet}, seq)
+		require.NoError(t, err)
+		seen := make(map[string]bool)
+		for i := 0; i < 5000; i++ {
+			code, err := gen.Generate("", 0)
+			require.NoError(t, err)
+			require.False(t, seen[code], "alphabet %q: duplicate code %s at %d", alphabet, code, i)
+			seen[code] = true
+		}
+	}
+}
+
+// Consecutive sequence values don't map to adjacent codes
+func TestSequenceCodesAreScattered(t *testing.T) {
+	gen, err := shortcode.New(shortcode.Config{Strategy: shortcode.StrategySequence}, &memSequence{})
+	require.NoError(t, err)
+	a, _ := gen.Generate("", 0)
+	b, _ := gen.Generate("", 0)
+	assert.Len(t, a, shortcode.DefaultLength)
+	assert.NotEqual(t, a[:4], b[:4])
+}
+
+func TestRandomCodesAreUnique(t *testing.T) {
+	gen, err := shortcode.New(shortcode.Config{Strategy: shortcode.StrategyRandom}, nil)
+	require.NoError(t, err)
+	seen := make(map[string]bool)
+	for i := 0; i < 20000; i++ {
+		code, err := gen.Generate(fmt.Sprint(i), 0)
+		require.NoError(t, err)
+		require.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+	}
+}
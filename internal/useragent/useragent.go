@@ -0,0 +1,128 @@
+// Package useragent classifies User-Agent and Referer headers without any external lookups.
+package useragent
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// Other is the browser or OS family of User-Agents that aren't recognized
+const Other = "Other"
+
+// Info is the parsed form of a User-Agent header
+type Info struct {
+	Device  string
+	Browser string
+	OS      string
+}
+
+// token maps a User-Agent substring to a family name; lists are checked in order
+type token struct {
+	match string
+	name  string
+}
+
+var botTokens = []string{
+	"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests", "go-http-client",
+	"facebookexternalhit", "headlesschrome", "preview", "httpclient", "okhttp", "java/",
+}
+
+var browserTokens = []token{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"yabrowser/", "Yandex"},
+	{"ucbrowser/", "UC Browser"},
+	{"fxios/", "Firefox"},
+	{"firefox/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"version/", "Safari"},
+}
+
+var osTokens = []token{
+	{"windows phone", "Windows Phone"},
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{"cros", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+// Parse classifies a User-Agent header into device class, browser family and OS family
+func Parse(ua string) Info {
+	s := strings.ToLower(strings.TrimSpace(ua))
+	if s == "" {
+		return Info{Device: DeviceUnknown, Browser: Other, OS: Other}
+	}
+	info := Info{
+		Browser: lookup(s, browserTokens),
+		OS:      lookup(s, osTokens),
+	}
+	// Safari is the fallback for WebKit browsers that identify with Version/ only
+	if info.Browser == "Safari" && !strings.Contains(s, "safari") {
+		info.Browser = Other
+	}
+	info.Device = device(s)
+	return info
+}
+
+func device(s string) string {
+	for _, b := range botTokens {
+		if strings.Contains(s, b) {
+			return DeviceBot
+		}
+	}
+	switch {
+	case strings.Contains(s, "ipad"), strings.Contains(s, "tablet"), strings.Contains(s, "kindle"),
+		strings.Contains(s, "silk/"), strings.Contains(s, "playbook"):
+		return DeviceTablet
+	case strings.Contains(s, "android") && !strings.Contains(s, "mobile"):
+		return DeviceTablet
+	case strings.Contains(s, "mobi"), strings.Contains(s, "iphone"), strings.Contains(s, "ipod"),
+		strings.Contains(s, "windows phone"), strings.Contains(s, "android"):
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
+
+func lookup(s string, tokens []token) string {
+	for _, t := range tokens {
+		if strings.Contains(s, t.match) {
+			return t.name
+		}
+	}
+	return Other
+}
+
+// ReferrerDomain returns the lower-cased host of a Referer header without a leading "www.",
+// or an empty string for direct traffic and unparsable values
+func ReferrerDomain(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(strings.TrimSpace(referrer))
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,67 @@
+package useragent_test
+
+import (
+	"testing"
+
+	"url-shortener/internal/useragent"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want useragent.Info
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			useragent.Info{Device: useragent.DeviceDesktop, Browser: "Chrome", OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0",
+			useragent.Info{Device: useragent.DeviceDesktop, Browser: "Edge", OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			useragent.Info{Device: useragent.DeviceMobile, Browser: "Safari", OS: "iOS"},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0 Mobile/15E148 Safari/604.1",
+			useragent.Info{Device: useragent.DeviceTablet, Browser: "Chrome", OS: "iOS"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36",
+			useragent.Info{Device: useragent.DeviceMobile, Browser: "Chrome", OS: "Android"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0 Safari/537.36",
+			useragent.Info{Device: useragent.DeviceTablet, Browser: "Samsung Internet", OS: "Android"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.5; rv:127.0) Gecko/20100101 Firefox/127.0",
+			useragent.Info{Device: useragent.DeviceDesktop, Browser: "Firefox", OS: "macOS"},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			useragent.Info{Device: useragent.DeviceBot, Browser: "Other", OS: "Other"},
+		},
+		{
+			"curl/8.5.0",
+			useragent.Info{Device: useragent.DeviceBot, Browser: "Other", OS: "Other"},
+		},
+		{
+			"",
+			useragent.Info{Device: useragent.DeviceUnknown, Browser: "Other", OS: "Other"},
+		},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, useragent.Parse(c.ua), c.ua)
+	}
+}
+
+func TestReferrerDomain(t *testing.T) {
+	assert.Equal(t, "news.ycombinator.com", useragent.ReferrerDomain("https://news.ycombinator.com/item?id=1"))
+	assert.Equal(t, "google.com", useragent.ReferrerDomain("https://WWW.Google.com/"))
+	assert.Equal(t, "", useragent.ReferrerDomain(""))
+	assert.Equal(t, "", useragent.ReferrerDomain("not a url"))
+}
@@ -0,0 +1,4 @@
+-- Up migration: only enforce uniqueness on non-empty custom aliases
+ALTER TABLE short_urls DROP CONSTRAINT IF EXISTS short_urls_custom_alias_key;
+DROP INDEX IF EXISTS idx_short_urls_custom_alias;
+CREATE UNIQUE INDEX idx_short_urls_custom_alias ON short_urls (custom_alias) WHERE custom_alias <> '';
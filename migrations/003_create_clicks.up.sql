@@ -0,0 +1,13 @@
+-- Up migration: per-click event log
+CREATE TABLE clicks (
+    id              BIGSERIAL PRIMARY KEY,
+    url_id          BIGINT       NOT NULL,
+    clicked_at      TIMESTAMPTZ  NOT NULL,
+    referrer        VARCHAR(2048),
+    user_agent      VARCHAR(1024),
+    ip_hash         VARCHAR(64),
+    accept_language VARCHAR(255)
+);
+
+CREATE INDEX idx_clicks_url_id ON clicks (url_id);
+CREATE INDEX idx_clicks_clicked_at ON clicks (clicked_at);
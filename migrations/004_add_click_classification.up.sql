@@ -0,0 +1,6 @@
+-- Up migration: parsed referrer and user agent fields for click breakdowns
+ALTER TABLE clicks
+    ADD COLUMN referrer_domain VARCHAR(255),
+    ADD COLUMN device VARCHAR(16),
+    ADD COLUMN browser VARCHAR(64),
+    ADD COLUMN os VARCHAR(64);
@@ -0,0 +1,4 @@
+-- Up migration: GeoIP attribution for clicks
+ALTER TABLE clicks
+    ADD COLUMN country VARCHAR(2),
+    ADD COLUMN city VARCHAR(255);
@@ -0,0 +1,5 @@
+-- Up migration: soft-delete support for short_urls
+ALTER TABLE short_urls
+    ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+CREATE INDEX idx_short_urls_deleted_at ON short_urls (deleted_at);
@@ -0,0 +1,5 @@
+-- Up migration: named counters backing the sequence short code strategy
+CREATE TABLE sequences (
+    name  VARCHAR(64) PRIMARY KEY,
+    value BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,5 @@
+-- Up migration: keep the owner's casing of custom aliases apart from the lookup key
+ALTER TABLE short_urls
+    ADD COLUMN custom_alias_display VARCHAR(255);
+
+UPDATE short_urls SET custom_alias_display = custom_alias WHERE custom_alias <> '';
@@ -0,0 +1,4 @@
+-- Up migration: links flagged by destination safety checks
+ALTER TABLE short_urls
+    ADD COLUMN quarantined BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN quarantine_reason VARCHAR(255);
@@ -0,0 +1,4 @@
+-- Up migration: preview page title and per-link forced preview
+ALTER TABLE short_urls
+    ADD COLUMN title VARCHAR(255),
+    ADD COLUMN force_preview BOOLEAN NOT NULL DEFAULT FALSE;
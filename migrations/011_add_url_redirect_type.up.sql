@@ -0,0 +1,3 @@
+-- Up migration: per-link redirect status code or HTML redirect
+ALTER TABLE short_urls
+    ADD COLUMN redirect_type VARCHAR(8);
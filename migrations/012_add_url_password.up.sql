@@ -0,0 +1,3 @@
+-- Up migration: optional bcrypt-hashed link password
+ALTER TABLE short_urls
+    ADD COLUMN password_hash VARCHAR(255);
@@ -0,0 +1,4 @@
+-- Down migration: drop scheduled activation
+ALTER TABLE short_urls
+    DROP COLUMN IF EXISTS coming_soon_url,
+    DROP COLUMN IF EXISTS activates_at;
@@ -0,0 +1,4 @@
+-- Up migration: scheduled activation with an optional "coming soon" destination
+ALTER TABLE short_urls
+    ADD COLUMN activates_at TIMESTAMPTZ,
+    ADD COLUMN coming_soon_url TEXT;
@@ -0,0 +1,8 @@
+-- Up migration: fallback URL or page for expired and exhausted links, per link and per user
+ALTER TABLE short_urls
+    ADD COLUMN fallback_url TEXT,
+    ADD COLUMN expired_page TEXT;
+
+ALTER TABLE users
+    ADD COLUMN fallback_url TEXT,
+    ADD COLUMN expired_page TEXT;
@@ -0,0 +1,23 @@
+-- Up migration: ordered per-link routing rules
+CREATE TABLE redirect_rules (
+    id          BIGSERIAL    PRIMARY KEY,
+    url_id      BIGINT       NOT NULL,
+    position    INTEGER      NOT NULL,
+    destination TEXT         NOT NULL,
+    devices     TEXT,
+    os          TEXT,
+    languages   TEXT,
+    countries   TEXT,
+    time_from   VARCHAR(5),
+    time_to     VARCHAR(5),
+    time_zone   VARCHAR(64),
+    starts_at   TIMESTAMPTZ,
+    ends_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_redirect_rules_url_id ON redirect_rules (url_id);
+
+-- Lets redirects skip loading rules for links without any
+ALTER TABLE short_urls
+    ADD COLUMN has_rules BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,17 @@
+-- Up migration: weighted A/B destinations and the variant each click was sent to
+CREATE TABLE link_variants (
+    id          BIGSERIAL    PRIMARY KEY,
+    url_id      BIGINT       NOT NULL,
+    label       VARCHAR(64),
+    destination TEXT         NOT NULL,
+    weight      INTEGER      NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_link_variants_url_id ON link_variants (url_id);
+
+ALTER TABLE short_urls
+    ADD COLUMN has_variants BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE clicks
+    ADD COLUMN variant_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Up migration: pass the short link's query string and extra path on to the destination
+ALTER TABLE short_urls
+    ADD COLUMN query_passthrough VARCHAR(16),
+    ADD COLUMN path_passthrough  BOOLEAN NOT NULL DEFAULT FALSE;